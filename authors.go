@@ -0,0 +1,237 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// AuthorDetail is an author together with all of their books.
+type AuthorDetail struct {
+	Author
+	Books []Book
+}
+
+// AuthorWithBooks loads an author and their books, ordered by id. It returns
+// sql.ErrNoRows if the author does not exist or has been soft-deleted.
+func AuthorWithBooks(db *sqlx.DB, authorID int) (AuthorDetail, error) {
+	var detail AuthorDetail
+	if err := db.Get(&detail.Author, "SELECT * FROM authors WHERE id=? AND deleted_at IS NULL", authorID); err != nil {
+		return AuthorDetail{}, err
+	}
+	detail.Books = []Book{}
+	if err := db.Select(&detail.Books, "SELECT * FROM books WHERE author_id=? ORDER BY id", authorID); err != nil {
+		return AuthorDetail{}, err
+	}
+	return detail, nil
+}
+
+// InsertAuthor inserts a and returns the new author id. Emails are unique
+// regardless of case, so an address that differs from an existing one only
+// by case is rejected with ErrDuplicateEmail.
+func InsertAuthor(db *sqlx.DB, a Author) (int64, error) {
+	if err := ValidateEmail(a.Email); err != nil {
+		return 0, err
+	}
+	result, err := db.NamedExec("INSERT INTO authors (name, email) VALUES (:name, :email)", a)
+	if isUniqueViolation(err) {
+		return 0, ErrDuplicateEmail
+	}
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+// ListAuthors returns all authors that are not soft-deleted, ordered by id.
+// BookCount is the cached value from the last RefreshAuthorBookCounts.
+func ListAuthors(db *sqlx.DB) ([]Author, error) {
+	authors := []Author{}
+	err := db.Select(&authors, "SELECT * FROM authors WHERE deleted_at IS NULL ORDER BY id")
+	return authors, err
+}
+
+// RefreshAuthorBookCounts recomputes the cached book_count of every author
+// in a single statement.
+func RefreshAuthorBookCounts(db *sqlx.DB) error {
+	_, err := db.Exec("UPDATE authors SET book_count = (SELECT COUNT(*) FROM books WHERE books.author_id = authors.id)")
+	return err
+}
+
+// AuthorsByName returns every author with exactly the given name, ordered by
+// id, leaving out soft-deleted authors. Names are not unique, so this may
+// return several authors or none.
+func AuthorsByName(db *sqlx.DB, name string) ([]Author, error) {
+	authors := []Author{}
+	err := db.Select(&authors, "SELECT * FROM authors WHERE name=? AND deleted_at IS NULL ORDER BY id", name)
+	return authors, err
+}
+
+const authorsByNameQuery = "SELECT * FROM authors WHERE name=:name AND deleted_at IS NULL ORDER BY id"
+
+// CachedAuthorsByName is AuthorsByName for hot paths: it runs the lookup
+// through a statement prepared once in cache.
+func CachedAuthorsByName(cache *NamedStmtCache, name string) ([]Author, error) {
+	stmt, err := cache.Prepare(authorsByNameQuery)
+	if err != nil {
+		return nil, err
+	}
+	authors := []Author{}
+	err = stmt.Select(&authors, map[string]interface{}{"name": name})
+	return authors, err
+}
+
+// EmailConflict is a set of authors whose emails become identical once
+// normalized.
+type EmailConflict struct {
+	Email     string
+	AuthorIDs []int
+}
+
+// EmailConflictError is returned by NormalizeAuthorEmails when normalizing
+// would give several authors the same email.
+type EmailConflictError struct {
+	Conflicts []EmailConflict
+}
+
+func (e *EmailConflictError) Error() string {
+	parts := make([]string, len(e.Conflicts))
+	for i, c := range e.Conflicts {
+		parts[i] = fmt.Sprintf("%s (authors %v)", c.Email, c.AuthorIDs)
+	}
+	return "conflicting emails after normalization: " + strings.Join(parts, ", ")
+}
+
+// NormalizeAuthorEmails lowercases and trims every author email and returns
+// the number of rows changed. If two or more authors would end up with the
+// same email, nothing is updated and an *EmailConflictError lists them.
+// Soft-deleted authors are included, since they still hold their email.
+func NormalizeAuthorEmails(db *sqlx.DB) (int64, error) {
+	return InTxValue(db, func(tx *sqlx.Tx) (int64, error) {
+		var rows []struct {
+			Email string `db:"email"`
+			ID    int    `db:"id"`
+		}
+		err := tx.Select(&rows, `SELECT LOWER(TRIM(email)) AS email, id FROM authors
+			WHERE LOWER(TRIM(email)) IN (
+				SELECT LOWER(TRIM(email)) FROM authors GROUP BY LOWER(TRIM(email)) HAVING COUNT(*) > 1
+			)
+			ORDER BY email, id`)
+		if err != nil {
+			return 0, err
+		}
+		if len(rows) > 0 {
+			conflictErr := &EmailConflictError{}
+			for _, r := range rows {
+				n := len(conflictErr.Conflicts)
+				if n == 0 || conflictErr.Conflicts[n-1].Email != r.Email {
+					conflictErr.Conflicts = append(conflictErr.Conflicts, EmailConflict{Email: r.Email})
+					n++
+				}
+				conflictErr.Conflicts[n-1].AuthorIDs = append(conflictErr.Conflicts[n-1].AuthorIDs, r.ID)
+			}
+			return 0, conflictErr
+		}
+
+		result, err := tx.Exec("UPDATE authors SET email=LOWER(TRIM(email)) WHERE email <> LOWER(TRIM(email))")
+		if err != nil {
+			return 0, err
+		}
+		return result.RowsAffected()
+	})
+}
+
+// LatestAuthor returns the most recently added author that has not been
+// soft-deleted, the one with the highest id. It returns sql.ErrNoRows if
+// there is no such author.
+func LatestAuthor(db *sqlx.DB) (Author, error) {
+	var author Author
+	err := db.Get(&author, "SELECT * FROM authors WHERE deleted_at IS NULL ORDER BY id DESC LIMIT 1")
+	return author, err
+}
+
+// TopAuthor returns the author with the most books along with that count,
+// ignoring soft-deleted authors. Ties go to the author with the lowest id.
+// It returns sql.ErrNoRows if no book has an existing, undeleted author.
+func TopAuthor(db *sqlx.DB) (Author, int, error) {
+	var row struct {
+		Author
+		Books int `db:"books"`
+	}
+	err := db.Get(&row, `SELECT authors.*, COUNT(*) AS books
+		FROM authors JOIN books ON books.author_id = authors.id
+		WHERE authors.deleted_at IS NULL
+		GROUP BY authors.id
+		ORDER BY books DESC, authors.id
+		LIMIT 1`)
+	if err != nil {
+		return Author{}, 0, err
+	}
+	return row.Author, row.Books, nil
+}
+
+// AuthorsWithExternalEmail returns authors, ordered by id, whose email is not
+// at domain (for example "codeheim.io"). The domain is matched literally and
+// case-insensitively. Soft-deleted authors are skipped.
+func AuthorsWithExternalEmail(db *sqlx.DB, domain string) ([]Author, error) {
+	authors := []Author{}
+	err := db.Select(&authors, `SELECT * FROM authors WHERE email NOT LIKE ? ESCAPE '\' AND deleted_at IS NULL ORDER BY id`,
+		"%@"+escapeLike(domain))
+	return authors, err
+}
+
+// SoftDeleteAuthor marks an author as deleted without removing the row. It
+// returns sql.ErrNoRows if the author does not exist or is already deleted.
+func SoftDeleteAuthor(db *sqlx.DB, authorID int) error {
+	result, err := db.Exec("UPDATE authors SET deleted_at=? WHERE id=? AND deleted_at IS NULL", time.Now().UTC(), authorID)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// OrphanBooksForDeletedAuthors clears the author of every book whose author
+// has been soft-deleted and returns how many books were changed.
+func OrphanBooksForDeletedAuthors(db *sqlx.DB) (int64, error) {
+	result, err := db.Exec(`UPDATE books SET author_id=NULL
+		WHERE author_id IN (SELECT id FROM authors WHERE deleted_at IS NOT NULL)`)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// AuthorBookCount is an author with the number of books currently credited
+// to them.
+type AuthorBookCount struct {
+	ID    int    `db:"id"`
+	Name  string `db:"name"`
+	Books int    `db:"books"`
+}
+
+// AuthorsPagedWithCounts returns one page of authors ordered by id, each with
+// a live count of their books, together with the total number of authors.
+// Soft-deleted authors are excluded from both.
+func AuthorsPagedWithCounts(db *sqlx.DB, limit, offset int) ([]AuthorBookCount, int, error) {
+	var total int
+	if err := db.Get(&total, "SELECT COUNT(*) FROM authors WHERE deleted_at IS NULL"); err != nil {
+		return nil, 0, err
+	}
+	page := []AuthorBookCount{}
+	err := db.Select(&page, `SELECT a.id, a.name, COUNT(b.id) AS books
+		FROM authors a LEFT JOIN books b ON b.author_id = a.id
+		WHERE a.deleted_at IS NULL
+		GROUP BY a.id ORDER BY a.id LIMIT ? OFFSET ?`, limit, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	return page, total, nil
+}
@@ -0,0 +1,285 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestAuthorWithBooks(t *testing.T) {
+	db := newTestDB(t)
+	db.MustExec("INSERT INTO authors (id, name, email) VALUES (1, 'Ann', 'ann@example.com'), (2, 'Bob', 'bob@example.com')")
+	db.MustExec("INSERT INTO books (id, title, author_id) VALUES (10, 'First', 1), (11, 'Second', 1), (12, 'Other', 2)")
+
+	d, err := AuthorWithBooks(db, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Name != "Ann" || len(d.Books) != 2 || d.Books[0].ID != 10 || d.Books[1].ID != 11 {
+		t.Errorf("AuthorWithBooks(1) = %+v", d)
+	}
+
+	db.MustExec("INSERT INTO authors (id, name, email) VALUES (3, 'Cy', 'cy@example.com')")
+	d, err = AuthorWithBooks(db, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Books == nil || len(d.Books) != 0 {
+		t.Errorf("author without books has Books = %#v, want empty slice", d.Books)
+	}
+
+	if _, err := AuthorWithBooks(db, 99); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("missing author: err = %v, want sql.ErrNoRows", err)
+	}
+}
+
+func TestAuthorsByName(t *testing.T) {
+	db := newTestDB(t)
+	db.MustExec(`INSERT INTO authors (id, name, email) VALUES
+		(1, 'Sam Lee', 'sam1@example.com'), (2, 'Other', 'o@example.com'), (3, 'Sam Lee', 'sam2@example.com')`)
+
+	got, err := AuthorsByName(db, "Sam Lee")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got[0].ID != 1 || got[1].ID != 3 {
+		t.Errorf("AuthorsByName(Sam Lee) = %+v, want ids 1 and 3", got)
+	}
+
+	got, err = AuthorsByName(db, "Nobody")
+	if err != nil || got == nil || len(got) != 0 {
+		t.Errorf("unknown name: %#v, %v, want empty slice", got, err)
+	}
+}
+
+func TestNormalizeAuthorEmails(t *testing.T) {
+	db := newTestDB(t)
+	db.MustExec(`INSERT INTO authors (name, email) VALUES
+		('A', '  Ann@Example.com '), ('B', 'bob@example.com'), ('C', 'CY@EXAMPLE.COM')`)
+	n, err := NormalizeAuthorEmails(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Errorf("changed %d emails, want 2", n)
+	}
+	var emails []string
+	if err := db.Select(&emails, "SELECT email FROM authors ORDER BY id"); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"ann@example.com", "bob@example.com", "cy@example.com"}; !reflect.DeepEqual(emails, want) {
+		t.Errorf("emails = %q, want %q", emails, want)
+	}
+}
+
+func TestNormalizeAuthorEmailsConflict(t *testing.T) {
+	db := newTestDB(t)
+	db.MustExec(`INSERT INTO authors (id, name, email) VALUES
+		(1, 'A', 'ann@example.com'), (2, 'A again', ' ann@example.com'), (3, 'B', ' Bob@example.com')`)
+	n, err := NormalizeAuthorEmails(db)
+	var conflictErr *EmailConflictError
+	if !errors.As(err, &conflictErr) {
+		t.Fatalf("err = %v, want *EmailConflictError", err)
+	}
+	want := []EmailConflict{{Email: "ann@example.com", AuthorIDs: []int{1, 2}}}
+	if n != 0 || !reflect.DeepEqual(conflictErr.Conflicts, want) {
+		t.Errorf("got %d, %+v, want conflicts %+v", n, conflictErr.Conflicts, want)
+	}
+	if !strings.Contains(err.Error(), "ann@example.com") {
+		t.Errorf("error %q does not name the email", err)
+	}
+	var bob string
+	if err := db.Get(&bob, "SELECT email FROM authors WHERE id=3"); err != nil {
+		t.Fatal(err)
+	}
+	if bob != " Bob@example.com" {
+		t.Errorf("non-conflicting email changed to %q despite the conflict", bob)
+	}
+}
+
+func TestRefreshAuthorBookCounts(t *testing.T) {
+	db := newTestDB(t)
+	db.MustExec("INSERT INTO authors (id, name, email) VALUES (1, 'Ann', 'ann@example.com'), (2, 'Bob', 'bob@example.com')")
+	db.MustExec("INSERT INTO books (title, author_id) VALUES ('A', 1), ('B', 1), ('C', 1)")
+	if err := RefreshAuthorBookCounts(db); err != nil {
+		t.Fatal(err)
+	}
+	authors, err := ListAuthors(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]int{}
+	for _, a := range authors {
+		got[a.Name] = a.BookCount
+	}
+	if want := map[string]int{"Ann": 3, "Bob": 0}; !reflect.DeepEqual(got, want) {
+		t.Errorf("book counts = %v, want %v", got, want)
+	}
+}
+
+func TestInsertAuthorDuplicateEmail(t *testing.T) {
+	db := newTestDB(t)
+	if _, err := InsertAuthor(db, Author{Name: "Ann", Email: "ann@example.com"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := InsertAuthor(db, Author{Name: "Ann", Email: "Ann@Example.com"}); !errors.Is(err, ErrDuplicateEmail) {
+		t.Errorf("case-variant email: %v, want ErrDuplicateEmail", err)
+	}
+	if _, err := InsertAuthor(db, Author{Name: "Ann", Email: "not an email"}); !errors.Is(err, ErrInvalidEmail) {
+		t.Errorf("invalid email: %v, want ErrInvalidEmail", err)
+	}
+	if n := count(t, db, "SELECT COUNT(*) FROM authors"); n != 1 {
+		t.Errorf("%d authors, want 1", n)
+	}
+}
+
+func TestLatestAuthor(t *testing.T) {
+	db := newTestDB(t)
+	if _, err := LatestAuthor(db); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("no authors: %v, want sql.ErrNoRows", err)
+	}
+	db.MustExec("INSERT INTO authors (id, name, email) VALUES (1, 'Ann', 'ann@example.com'), (3, 'Cat', 'cat@example.com'), (2, 'Bob', 'bob@example.com')")
+	a, err := LatestAuthor(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.ID != 3 || a.Name != "Cat" {
+		t.Errorf("latest author = %+v, want Cat", a)
+	}
+}
+
+func TestTopAuthor(t *testing.T) {
+	db := newTestDB(t)
+	if _, _, err := TopAuthor(db); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("no books: %v, want sql.ErrNoRows", err)
+	}
+	db.MustExec("INSERT INTO authors (id, name, email) VALUES (1, 'Ann', 'ann@example.com'), (2, 'Bob', 'bob@example.com'), (3, 'Cat', 'cat@example.com')")
+	db.MustExec("INSERT INTO books (title, author_id) VALUES ('A', 2), ('B', 2), ('C', 3), ('D', 3), ('E', 1), ('F', 99), ('G', 99), ('H', 99)")
+	a, n, err := TopAuthor(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.ID != 2 || n != 2 {
+		t.Errorf("top author = %d with %d books, want 2 with 2 (lowest id wins ties)", a.ID, n)
+	}
+}
+
+func TestAuthorsWithExternalEmail(t *testing.T) {
+	db := newTestDB(t)
+	db.MustExec(`INSERT INTO authors (id, name, email) VALUES (1, 'In', 'in@codeheim.io'), (2, 'Upper', 'up@CodeHeim.IO'),
+		(3, 'Out', 'out@example.com'), (4, 'Sub', 'sub@mail.codeheim.io'), (5, 'Lookalike', 'x@codeheimxio'),
+		(6, 'Gone', 'gone@example.com')`)
+	if err := SoftDeleteAuthor(db, 6); err != nil {
+		t.Fatal(err)
+	}
+	authors, err := AuthorsWithExternalEmail(db, "codeheim.io")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []int
+	for _, a := range authors {
+		ids = append(ids, a.ID)
+	}
+	if want := []int{3, 4, 5}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("external authors = %v, want %v", ids, want)
+	}
+}
+
+func TestSoftDeleteAuthor(t *testing.T) {
+	db := newTestDB(t)
+	db.MustExec("INSERT INTO authors (id, name, email) VALUES (1, 'Ann', 'ann@example.com'), (2, 'Ann', 'ann2@example.com'), (3, 'Bob', 'bob@example.com')")
+	db.MustExec("INSERT INTO books (id, title, author_id) VALUES (10, 'A', 2), (11, 'B', 2), (12, 'C', 3)")
+
+	if err := SoftDeleteAuthor(db, 2); err != nil {
+		t.Fatal(err)
+	}
+	if err := SoftDeleteAuthor(db, 2); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("second delete: %v, want sql.ErrNoRows", err)
+	}
+	if err := SoftDeleteAuthor(db, 99); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("missing author: %v, want sql.ErrNoRows", err)
+	}
+	if n := count(t, db, "SELECT COUNT(*) FROM authors WHERE id=2 AND deleted_at IS NOT NULL"); n != 1 {
+		t.Error("row not kept with deleted_at set")
+	}
+
+	authors, err := ListAuthors(db)
+	if err != nil || len(authors) != 2 || authors[0].ID != 1 || authors[1].ID != 3 {
+		t.Errorf("ListAuthors = %+v, %v, want 1 and 3", authors, err)
+	}
+	if _, err := AuthorWithBooks(db, 2); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("AuthorWithBooks(deleted): %v, want sql.ErrNoRows", err)
+	}
+	if byName, err := AuthorsByName(db, "Ann"); err != nil || len(byName) != 1 || byName[0].ID != 1 {
+		t.Errorf("AuthorsByName = %+v, %v, want only 1", byName, err)
+	}
+	cache := NewNamedStmtCache(db)
+	defer cache.Close()
+	if byName, err := CachedAuthorsByName(cache, "Ann"); err != nil || len(byName) != 1 || byName[0].ID != 1 {
+		t.Errorf("CachedAuthorsByName = %+v, %v, want only 1", byName, err)
+	}
+	// Author 2 has the most books but is deleted.
+	if a, n, err := TopAuthor(db); err != nil || a.ID != 3 || n != 1 {
+		t.Errorf("TopAuthor = %d with %d, %v, want 3 with 1", a.ID, n, err)
+	}
+	if err := SoftDeleteAuthor(db, 3); err != nil {
+		t.Fatal(err)
+	}
+	if a, err := LatestAuthor(db); err != nil || a.ID != 1 {
+		t.Errorf("LatestAuthor = %d, %v, want 1", a.ID, err)
+	}
+}
+
+func TestOrphanBooksForDeletedAuthors(t *testing.T) {
+	db := newTestDB(t)
+	db.MustExec("INSERT INTO authors (id, name, email) VALUES (1, 'Ann', 'ann@example.com'), (2, 'Bob', 'bob@example.com')")
+	db.MustExec("INSERT INTO books (id, title, author_id) VALUES (10, 'A', 1), (11, 'B', 2), (12, 'C', 2)")
+	if err := SoftDeleteAuthor(db, 2); err != nil {
+		t.Fatal(err)
+	}
+	n, err := OrphanBooksForDeletedAuthors(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Errorf("orphaned %d books, want 2", n)
+	}
+	if got := count(t, db, "SELECT COUNT(*) FROM books WHERE author_id IS NULL"); got != 2 {
+		t.Errorf("%d books without author, want 2", got)
+	}
+	if got := count(t, db, "SELECT COUNT(*) FROM books WHERE id=10 AND author_id=1"); got != 1 {
+		t.Error("book of a live author was orphaned")
+	}
+}
+
+func TestAuthorsPagedWithCounts(t *testing.T) {
+	db := newTestDB(t)
+	for i := 1; i <= 5; i++ {
+		db.MustExec("INSERT INTO authors (id, name, email) VALUES (?, ?, ?)", i, string(rune('A'+i-1)), string(rune('a'+i-1))+"@example.com")
+	}
+	db.MustExec("INSERT INTO books (title, author_id) VALUES ('x', 1), ('y', 1), ('z', 3), ('w', 4)")
+	if err := SoftDeleteAuthor(db, 2); err != nil {
+		t.Fatal(err)
+	}
+
+	page, total, err := AuthorsPagedWithCounts(db, 2, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []AuthorBookCount{{1, "A", 2}, {3, "C", 1}}
+	if total != 4 || !reflect.DeepEqual(page, want) {
+		t.Errorf("first page = %+v of %d, want %+v of 4", page, total, want)
+	}
+	page, _, err = AuthorsPagedWithCounts(db, 2, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []AuthorBookCount{{4, "D", 1}, {5, "E", 0}}; !reflect.DeepEqual(page, want) {
+		t.Errorf("second page = %+v, want %+v", page, want)
+	}
+	if page, _, _ = AuthorsPagedWithCounts(db, 2, 10); page == nil || len(page) != 0 {
+		t.Errorf("past the end: %#v, want empty page", page)
+	}
+}
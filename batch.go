@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"reflect"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// ProgressEvery is how many rows NamedExecBatch executes between calls to
+// its progress callback.
+var ProgressEvery = 100
+
+// NamedExecBatch executes query once per element of args within a single
+// transaction. onProgress, if non-nil, is called with the number of rows done
+// after every ProgressEvery rows and once more at the end. If ctx is
+// cancelled or any row fails, the whole batch is rolled back.
+func NamedExecBatch(ctx context.Context, db *sqlx.DB, query string, args []interface{}, onProgress func(done int)) error {
+	tx, err := db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for i, arg := range args {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if _, err := tx.NamedExecContext(ctx, query, arg); err != nil {
+			return err
+		}
+		if done := i + 1; onProgress != nil && ProgressEvery > 0 && done%ProgressEvery == 0 && done != len(args) {
+			onProgress(done)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	if onProgress != nil {
+		onProgress(len(args))
+	}
+	return nil
+}
+
+// NamedExecChunked runs a batch NamedExec, such as a multi-row INSERT over a
+// slice of structs, in chunks of at most chunkSize elements so that no single
+// statement exceeds SQLite's parameter limit. All chunks run in one
+// transaction and the rows affected are summed.
+func NamedExecChunked(db *sqlx.DB, query string, slice interface{}, chunkSize int) (int64, error) {
+	if chunkSize <= 0 {
+		return 0, errors.New("chunkSize must be positive")
+	}
+	v := reflect.ValueOf(slice)
+	if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+		return 0, errors.New("NamedExecChunked requires a slice or array")
+	}
+	if v.Kind() == reflect.Array {
+		// Slicing needs an addressable array, which a value passed in an
+		// interface is not, so work on a copy.
+		arr := reflect.New(v.Type()).Elem()
+		arr.Set(v)
+		v = arr
+	}
+	return InTxValue(db, func(tx *sqlx.Tx) (int64, error) {
+		var affected int64
+		for start := 0; start < v.Len(); start += chunkSize {
+			end := min(start+chunkSize, v.Len())
+			result, err := tx.NamedExec(query, v.Slice(start, end).Interface())
+			if err != nil {
+				return 0, err
+			}
+			n, err := result.RowsAffected()
+			if err != nil {
+				return 0, err
+			}
+			affected += n
+		}
+		return affected, nil
+	})
+}
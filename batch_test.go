@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+// sequenceArgs returns n named args for inserting distinct sequences.
+func sequenceArgs(n int) []interface{} {
+	args := make([]interface{}, n)
+	for i := range args {
+		args[i] = map[string]interface{}{"name": fmt.Sprintf("seq%d", i), "value": i}
+	}
+	return args
+}
+
+const insertSequence = "INSERT INTO sequences (name, value) VALUES (:name, :value)"
+
+func TestNamedExecBatchProgress(t *testing.T) {
+	db := newTestDB(t)
+	var progress []int
+	err := NamedExecBatch(context.Background(), db, insertSequence, sequenceArgs(250), func(done int) {
+		progress = append(progress, done)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []int{100, 200, 250}; !reflect.DeepEqual(progress, want) {
+		t.Errorf("progress = %v, want %v", progress, want)
+	}
+	if n := count(t, db, "SELECT COUNT(*) FROM sequences"); n != 250 {
+		t.Errorf("%d rows inserted, want 250", n)
+	}
+}
+
+func TestNamedExecBatchCancel(t *testing.T) {
+	db := newTestDB(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	err := NamedExecBatch(ctx, db, insertSequence, sequenceArgs(250), func(done int) {
+		if done == 100 {
+			cancel()
+		}
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("got %v, want context.Canceled", err)
+	}
+	if n := count(t, db, "SELECT COUNT(*) FROM sequences"); n != 0 {
+		t.Errorf("%d rows left after cancel, want 0", n)
+	}
+}
+
+func TestNamedExecChunked(t *testing.T) {
+	db := newTestDB(t)
+	members := make([]Member, 5000)
+	for i := range members {
+		members[i] = Member{Name: fmt.Sprintf("Member %d", i), Email: fmt.Sprintf("m%d@example.com", i)}
+	}
+	n, err := NamedExecChunked(db, "INSERT INTO members (name, email) VALUES (:name, :email)", members, 500)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 5000 {
+		t.Errorf("rows affected = %d, want 5000", n)
+	}
+	if got := count(t, db, "SELECT COUNT(*) FROM members"); got != 5000 {
+		t.Errorf("%d members inserted, want 5000", got)
+	}
+}
+
+func TestNamedExecChunkedArray(t *testing.T) {
+	db := newTestDB(t)
+	members := [3]Member{
+		{Name: "Ann", Email: "ann@example.com"},
+		{Name: "Bob", Email: "bob@example.com"},
+		{Name: "Cy", Email: "cy@example.com"},
+	}
+	n, err := NamedExecChunked(db, "INSERT INTO members (name, email) VALUES (:name, :email)", members, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 3 {
+		t.Errorf("rows affected = %d, want 3", n)
+	}
+	if got := count(t, db, "SELECT COUNT(*) FROM members"); got != 3 {
+		t.Errorf("%d members inserted, want 3", got)
+	}
+}
+
+func TestNamedExecChunkedRollsBack(t *testing.T) {
+	db := newTestDB(t)
+	members := make([]Member, 1200)
+	for i := range members {
+		members[i] = Member{Name: "M", Email: fmt.Sprintf("m%d@example.com", i)}
+	}
+	members[1100].Email = members[0].Email // fails in the third chunk
+	if _, err := NamedExecChunked(db, "INSERT INTO members (name, email) VALUES (:name, :email)", members, 500); err == nil {
+		t.Fatal("duplicate email not reported")
+	}
+	if got := count(t, db, "SELECT COUNT(*) FROM members"); got != 0 {
+		t.Errorf("%d members left after failed batch, want 0", got)
+	}
+	if _, err := NamedExecChunked(db, "INSERT INTO members (name, email) VALUES (:name, :email)", members, 0); err == nil {
+		t.Error("zero chunk size accepted")
+	}
+}
@@ -0,0 +1,579 @@
+package main
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// DefaultGenre, when non-nil, is stored by InsertBook and the book imports
+// for books that have no genre. Leave it nil to keep missing genres as NULL.
+var DefaultGenre *string
+
+// genres maps a lowercased genre with spaces, hyphens and underscores
+// removed to its canonical spelling. Aliases map to the same spelling as the
+// genre they stand for.
+var genres = map[string]string{
+	"fiction":        "Fiction",
+	"nonfiction":     "Non-Fiction",
+	"scifi":          "Sci-Fi",
+	"sf":             "Sci-Fi",
+	"sciencefiction": "Sci-Fi",
+	"fantasy":        "Fantasy",
+	"mystery":        "Mystery",
+	"crime":          "Mystery",
+	"romance":        "Romance",
+	"horror":         "Horror",
+	"biography":      "Biography",
+	"bio":            "Biography",
+	"history":        "History",
+	"poetry":         "Poetry",
+}
+
+var genreSeparators = strings.NewReplacer(" ", "", "-", "", "_", "")
+
+// NormalizeGenre returns the canonical spelling of genre and whether it is a
+// known genre or alias, ignoring case, surrounding whitespace and
+// separators, so "  sci fi" and "SCIFI" both give "Sci-Fi". An unknown genre
+// is returned trimmed but otherwise as-is, and blank input gives "".
+func NormalizeGenre(s string) (string, bool) {
+	s = strings.TrimSpace(s)
+	if canonical, ok := genres[genreSeparators.Replace(strings.ToLower(s))]; ok {
+		return canonical, true
+	}
+	return s, false
+}
+
+// ErrFutureYear is returned for a book published after the current year.
+var ErrFutureYear = errors.New("published year is in the future")
+
+// clock is the clock used to validate books; tests may replace it.
+var clock = time.Now
+
+// ValidateYear returns ErrFutureYear if the book's published year is later
+// than the year of now. An unknown year is always valid.
+func (b Book) ValidateYear(now time.Time) error {
+	if b.PublishedYear.Valid && b.PublishedYear.Int64 > int64(now.Year()) {
+		return fmt.Errorf("%w: %d", ErrFutureYear, b.PublishedYear.Int64)
+	}
+	return nil
+}
+
+// prepareBook applies the rules InsertBook and the imports share: it rejects
+// a future published year and fills in the stored genre and copies.
+func prepareBook(b Book) (Book, error) {
+	if err := b.ValidateYear(clock()); err != nil {
+		return Book{}, err
+	}
+	if b.Genre.Valid {
+		genre, _ := NormalizeGenre(b.Genre.String)
+		b.Genre = sql.NullString{String: genre, Valid: genre != ""}
+	}
+	if !b.Genre.Valid && DefaultGenre != nil {
+		b.Genre = sql.NullString{String: *DefaultGenre, Valid: true}
+	}
+	if b.Copies == 0 {
+		b.Copies = 1
+	}
+	return b, nil
+}
+
+// InsertBook inserts b and returns the new book id. A zero Copies is stored
+// as a single copy, genres are stored in their NormalizeGenre spelling and a
+// blank genre counts as none. Books published in the future are rejected
+// with ErrFutureYear.
+func InsertBook(db *sqlx.DB, b Book) (int64, error) {
+	return insertBook(db, b)
+}
+
+// insertBook implements InsertBook on a database or transaction.
+func insertBook(e sqlx.Ext, b Book) (int64, error) {
+	b, err := prepareBook(b)
+	if err != nil {
+		return 0, err
+	}
+	result, err := sqlx.NamedExec(e, `INSERT INTO books (title, author_id, published_year, genre, metadata, copies)
+		VALUES (:title, :author_id, :published_year, :genre, :metadata, :copies)`, b)
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+// SelectBooksFast returns all books ordered by id, like
+// db.Select(&books, "SELECT * FROM books ORDER BY id"), but scans columns
+// directly instead of through reflection and sizes the slice up front. Use
+// it for large result sets; see BenchmarkSelectBooks.
+//
+// The up-front COUNT(*) is deliberate: over 10k rows it saves about a third
+// of the bytes allocated compared with growing the slice by append, which
+// outweighs the extra round trip. The count is only a capacity hint, so rows
+// added in between are still returned. Reusing a prepared statement for the
+// main query made no measurable difference and is not done.
+func SelectBooksFast(db *sqlx.DB) ([]Book, error) {
+	var n int
+	if err := db.Get(&n, "SELECT COUNT(*) FROM books"); err != nil {
+		return nil, err
+	}
+	rows, err := db.Query("SELECT id, title, author_id, published_year, genre, metadata, copies, updated_at FROM books ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	books := make([]Book, 0, n)
+	for rows.Next() {
+		var b Book
+		if err := rows.Scan(&b.ID, &b.Title, &b.AuthorID, &b.PublishedYear, &b.Genre, &b.Metadata, &b.Copies, &b.UpdatedAt); err != nil {
+			return nil, err
+		}
+		books = append(books, b)
+	}
+	return books, rows.Err()
+}
+
+// DecadeCount is the number of books published in a decade.
+type DecadeCount struct {
+	Decade int `db:"decade"`
+	Count  int `db:"count"`
+}
+
+// BooksByDecade counts books per publication decade (1990, 2000, ...) in
+// ascending order. Books without a published year are left out.
+func BooksByDecade(db *sqlx.DB) ([]DecadeCount, error) {
+	counts := []DecadeCount{}
+	err := db.Select(&counts, `SELECT (published_year/10)*10 AS decade, COUNT(*) AS count
+		FROM books
+		WHERE published_year IS NOT NULL
+		GROUP BY decade
+		ORDER BY decade`)
+	return counts, err
+}
+
+// RenameGenre changes every book in genre from to genre to, in a single
+// transaction, and returns the number of books updated. If to is already in
+// use the two genres simply merge. Books with a NULL genre are never touched.
+func RenameGenre(db *sqlx.DB, from, to string) (int64, error) {
+	return InTxValue(db, func(tx *sqlx.Tx) (int64, error) {
+		result, err := tx.Exec("UPDATE books SET genre=? WHERE genre=?", to, from)
+		if err != nil {
+			return 0, err
+		}
+		return result.RowsAffected()
+	})
+}
+
+// DistinctGenres returns every non-NULL genre in use, sorted alphabetically.
+func DistinctGenres(db *sqlx.DB) ([]string, error) {
+	genres := []string{}
+	err := db.Select(&genres, "SELECT DISTINCT genre FROM books WHERE genre IS NOT NULL ORDER BY genre")
+	return genres, err
+}
+
+// DistinctYears returns every known publication year, newest first.
+func DistinctYears(db *sqlx.DB) ([]int, error) {
+	years := []int{}
+	err := db.Select(&years, "SELECT DISTINCT published_year FROM books WHERE published_year IS NOT NULL ORDER BY published_year DESC")
+	return years, err
+}
+
+// TransferBook reassigns a book to another author. It returns
+// ErrAuthorNotFound if the new author does not exist or is soft-deleted, and
+// sql.ErrNoRows if the book does not exist.
+func TransferBook(db *sqlx.DB, bookID, newAuthorID int) error {
+	return InTx(db, func(tx *sqlx.Tx) error {
+		var exists bool
+		if err := tx.Get(&exists, "SELECT EXISTS(SELECT 1 FROM authors WHERE id=? AND deleted_at IS NULL)", newAuthorID); err != nil {
+			return err
+		}
+		if !exists {
+			return ErrAuthorNotFound
+		}
+		result, err := tx.Exec("UPDATE books SET author_id=? WHERE id=?", newAuthorID, bookID)
+		if err != nil {
+			return err
+		}
+		if n, err := result.RowsAffected(); err != nil {
+			return err
+		} else if n == 0 {
+			return sql.ErrNoRows
+		}
+		return nil
+	})
+}
+
+// BulkSetGenres sets the genre of several books in one UPDATE using a CASE
+// expression keyed on id, and returns the number of books updated.
+func BulkSetGenres(db *sqlx.DB, updates map[int]string) (int64, error) {
+	if len(updates) == 0 {
+		return 0, nil
+	}
+	ids := make([]int, 0, len(updates))
+	for id := range updates {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+
+	var q strings.Builder
+	args := make([]interface{}, 0, 2*len(ids)+1)
+	q.WriteString("UPDATE books SET genre = CASE id")
+	for _, id := range ids {
+		q.WriteString(" WHEN ? THEN ?")
+		args = append(args, id, updates[id])
+	}
+	q.WriteString(" END WHERE id IN (?)")
+	query, args, err := sqlx.In(q.String(), append(args, ids)...)
+	if err != nil {
+		return 0, err
+	}
+	result, err := db.Exec(db.Rebind(query), args...)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// NeverBorrowedBooks returns books that have never been loaned out, ordered
+// by id. A book that was borrowed and returned does not count as unborrowed.
+func NeverBorrowedBooks(db *sqlx.DB) ([]Book, error) {
+	books := []Book{}
+	err := db.Select(&books, `SELECT * FROM books
+		WHERE NOT EXISTS (SELECT 1 FROM loans WHERE loans.book_id = books.id)
+		ORDER BY id`)
+	return books, err
+}
+
+// bookManagedColumns are maintained by the database layer itself and cannot
+// be set through UpdateBookFields.
+var bookManagedColumns = map[string]bool{"id": true, "updated_at": true}
+
+// DiffBooks compares two versions of a book and returns the columns whose
+// stored values differ, mapped to their values in new; two NULLs are equal
+// even if their unused fields are not. The id and updated_at are never
+// included. The result can be passed straight to UpdateBookFields.
+func DiffBooks(old, new Book) map[string]interface{} {
+	changes := map[string]interface{}{}
+	oldFields := dbFields(old)
+	for i, f := range dbFields(new) {
+		if bookManagedColumns[f.Column] {
+			continue
+		}
+		if !sameDBValue(oldFields[i].Value, f.Value) {
+			changes[f.Column] = f.Value
+		}
+	}
+	return changes
+}
+
+// sameDBValue reports whether a and b would be stored as the same value.
+// Valuers such as sql.NullString are compared by their driver values, so two
+// NULLs are equal whatever their unused String fields hold.
+func sameDBValue(a, b interface{}) bool {
+	av, aok := a.(driver.Valuer)
+	bv, bok := b.(driver.Valuer)
+	if aok && bok {
+		ad, aerr := av.Value()
+		bd, berr := bv.Value()
+		if aerr == nil && berr == nil {
+			return reflect.DeepEqual(ad, bd)
+		}
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+// UpdateBook saves every field of b to the book with id b.ID, like
+// UpdateBookFields with all columns.
+func UpdateBook(db *sqlx.DB, b Book) error {
+	fields := map[string]interface{}{}
+	for _, f := range dbFields(b) {
+		if !bookManagedColumns[f.Column] {
+			fields[f.Column] = f.Value
+		}
+	}
+	return UpdateBookFields(db, b.ID, fields)
+}
+
+// publishedYear converts a published_year value as the driver would store
+// it, so that any integer type or driver.Valuer can be checked. Values that
+// are not integers or NULL are rejected.
+func publishedYear(v interface{}) (sql.NullInt64, error) {
+	var year sql.NullInt64
+	dv, err := driver.DefaultParameterConverter.ConvertValue(v)
+	if err == nil {
+		err = year.Scan(dv)
+	}
+	if err != nil {
+		return sql.NullInt64{}, fmt.Errorf("published_year %v: %w", v, err)
+	}
+	return year, nil
+}
+
+// UpdateBookFields updates only the given columns of a book and sets its
+// updated_at to the current time. Column names must be db tags of Book
+// other than id and updated_at. A published_year must be an integer or NULL
+// and one in the future is rejected with ErrFutureYear. It returns
+// sql.ErrNoRows if the book does not exist; an empty fields map is a no-op.
+func UpdateBookFields(db *sqlx.DB, bookID int, fields map[string]interface{}) error {
+	if len(fields) == 0 {
+		return nil
+	}
+	allowed := map[string]bool{}
+	for _, f := range dbFields(Book{}) {
+		allowed[f.Column] = !bookManagedColumns[f.Column]
+	}
+	columns := make([]string, 0, len(fields))
+	for column := range fields {
+		if !allowed[column] {
+			return fmt.Errorf("cannot update book column %q", column)
+		}
+		columns = append(columns, column)
+	}
+	if v, ok := fields["published_year"]; ok {
+		year, err := publishedYear(v)
+		if err != nil {
+			return err
+		}
+		if err := (Book{PublishedYear: year}).ValidateYear(clock()); err != nil {
+			return err
+		}
+	}
+	sort.Strings(columns)
+
+	sets := make([]string, len(columns))
+	args := make([]interface{}, 0, len(columns)+1)
+	for i, column := range columns {
+		sets[i] = column + "=?"
+		args = append(args, fields[column])
+	}
+	args = append(args, bookID)
+	result, err := db.Exec("UPDATE books SET "+strings.Join(sets, ", ")+", updated_at=CURRENT_TIMESTAMP WHERE id=?", args...)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// AutocompleteTitles returns up to limit distinct titles starting with
+// prefix, in alphabetical order. Wildcards in prefix match literally, and an
+// empty prefix returns the first titles overall.
+func AutocompleteTitles(db *sqlx.DB, prefix string, limit int) ([]string, error) {
+	titles := []string{}
+	err := db.Select(&titles, `SELECT DISTINCT title FROM books
+		WHERE title LIKE ? ESCAPE '\'
+		ORDER BY title
+		LIMIT ?`, escapeLike(prefix)+"%", limit)
+	return titles, err
+}
+
+// CloneBook inserts a copy of a book with " (Copy)" appended to its title and
+// returns the new id. All other fields, including a NULL genre, are copied
+// as they are. It returns sql.ErrNoRows if the source book does not exist.
+func CloneBook(db *sqlx.DB, bookID int) (int64, error) {
+	result, err := db.Exec(`INSERT INTO books (title, author_id, published_year, genre, metadata, copies)
+		SELECT title || ' (Copy)', author_id, published_year, genre, metadata, copies FROM books WHERE id=?`, bookID)
+	if err != nil {
+		return 0, err
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return 0, err
+	} else if n == 0 {
+		return 0, sql.ErrNoRows
+	}
+	return result.LastInsertId()
+}
+
+// BookAvailability is a book together with whether a copy can be borrowed.
+type BookAvailability struct {
+	Book
+	Available bool `db:"available"`
+}
+
+// BookWithAvailability returns a book and whether it is free to borrow, that
+// is, has fewer active loans than copies. It returns sql.ErrNoRows if the
+// book does not exist.
+func BookWithAvailability(db *sqlx.DB, bookID int) (BookAvailability, error) {
+	var book BookAvailability
+	err := db.Get(&book, `SELECT books.*,
+		(SELECT COUNT(*) FROM loans WHERE loans.book_id = books.id AND loans.return_date IS NULL) < books.copies AS available
+		FROM books WHERE books.id=?`, bookID)
+	return book, err
+}
+
+// BooksWithUnknownYear returns books whose published year is NULL, ordered
+// by id.
+func BooksWithUnknownYear(db *sqlx.DB) ([]Book, error) {
+	books := []Book{}
+	err := db.Select(&books, "SELECT * FROM books WHERE published_year IS NULL ORDER BY id")
+	return books, err
+}
+
+// SetBookYear sets a book's published year. It returns ErrFutureYear for a
+// year after the current one and sql.ErrNoRows if the book does not exist.
+func SetBookYear(db *sqlx.DB, bookID, year int) error {
+	return UpdateBookFields(db, bookID, map[string]interface{}{"published_year": year})
+}
+
+// BooksByIDMap loads the books with the given ids in one query and returns
+// them keyed by id. Ids with no matching book are absent from the map.
+func BooksByIDMap(db *sqlx.DB, ids []int) (map[int]Book, error) {
+	byID := make(map[int]Book, len(ids))
+	if len(ids) == 0 {
+		return byID, nil
+	}
+	query, args, err := sqlx.In("SELECT * FROM books WHERE id IN (?)", ids)
+	if err != nil {
+		return nil, err
+	}
+	var books []Book
+	if err := db.Select(&books, db.Rebind(query), args...); err != nil {
+		return nil, err
+	}
+	for _, b := range books {
+		byID[b.ID] = b
+	}
+	return byID, nil
+}
+
+// BooksUpdatedSince returns books changed through UpdateBook or
+// UpdateBookFields at or after since, ordered by update time. updated_at has
+// one-second resolution, so since is truncated to the second. Books never
+// updated since insertion are not returned.
+func BooksUpdatedSince(db *sqlx.DB, since time.Time) ([]Book, error) {
+	books := []Book{}
+	err := db.Select(&books, "SELECT * FROM books WHERE updated_at >= ? ORDER BY updated_at, id",
+		since.UTC().Format("2006-01-02 15:04:05"))
+	return books, err
+}
+
+// bookSortColumns are the columns ListBooksSorted can order by.
+var bookSortColumns = map[string]bool{"title": true, "published_year": true, "genre": true}
+
+// ListBooksSorted returns all books ordered by column (title,
+// published_year or genre), ties broken by id. NULLs come first when
+// nullsFirst is set and last otherwise, independent of the driver's default.
+func ListBooksSorted(db *sqlx.DB, column string, nullsFirst bool) ([]Book, error) {
+	if !bookSortColumns[column] {
+		return nil, fmt.Errorf("cannot sort books by %q", column)
+	}
+	nulls := "ASC"
+	if nullsFirst {
+		nulls = "DESC"
+	}
+	books := []Book{}
+	err := db.Select(&books, "SELECT * FROM books ORDER BY ("+column+" IS NULL) "+nulls+", "+column+", id")
+	return books, err
+}
+
+// BookByISBN returns the book whose metadata has the given "isbn" value. If
+// several books share an ISBN the one with the lowest id is returned. It
+// returns sql.ErrNoRows if no book matches.
+func BookByISBN(db *sqlx.DB, isbn string) (Book, error) {
+	var b Book
+	err := db.Get(&b, "SELECT * FROM books WHERE json_extract(metadata, '$.isbn')=? ORDER BY id LIMIT 1", isbn)
+	return b, err
+}
+
+// OldestBook returns the book with the earliest known publication year,
+// breaking ties by lowest id. It returns sql.ErrNoRows if no book has a
+// year.
+func OldestBook(db *sqlx.DB) (Book, error) {
+	var b Book
+	err := db.Get(&b, "SELECT * FROM books WHERE published_year IS NOT NULL ORDER BY published_year, id LIMIT 1")
+	return b, err
+}
+
+// maxRandomBooks caps how many books RandomBooks returns, since ORDER BY
+// RANDOM() sorts the whole table.
+const maxRandomBooks = 100
+
+// RandomBooks returns up to n books in random order, or all books if there
+// are fewer. n is clamped to between 0 and maxRandomBooks.
+func RandomBooks(db *sqlx.DB, n int) ([]Book, error) {
+	if n > maxRandomBooks {
+		n = maxRandomBooks
+	}
+	books := []Book{}
+	if n <= 0 {
+		return books, nil
+	}
+	err := db.Select(&books, "SELECT * FROM books ORDER BY RANDOM() LIMIT ?", n)
+	return books, err
+}
+
+// CatalogRow is one line of the catalog: a book, its author and whether a
+// copy can be borrowed.
+type CatalogRow struct {
+	BookID     int    `db:"book_id"`
+	Title      string `db:"title"`
+	AuthorName string `db:"author_name"`
+	Available  bool   `db:"available"`
+}
+
+// CatalogView returns every book ordered by title and id, with its author's
+// name and availability, in a single query. AuthorName is empty for a book
+// without an existing author or whose author is soft-deleted.
+func CatalogView(db *sqlx.DB) ([]CatalogRow, error) {
+	rows := []CatalogRow{}
+	err := db.Select(&rows, `SELECT books.id AS book_id, books.title,
+			COALESCE(authors.name, '') AS author_name,
+			COALESCE(active.n, 0) < books.copies AS available
+		FROM books
+		LEFT JOIN authors ON authors.id = books.author_id AND authors.deleted_at IS NULL
+		LEFT JOIN (SELECT book_id, COUNT(*) AS n FROM loans WHERE return_date IS NULL GROUP BY book_id) AS active
+			ON active.book_id = books.id
+		ORDER BY books.title, books.id`)
+	return rows, err
+}
+
+// FixOrphanBooks repairs books whose author_id points at no author, as can
+// happen after inserts with foreign keys disabled. Each such book is moved
+// to fallbackAuthorID, or has its author cleared if fallbackAuthorID is nil.
+// It returns the number of books repaired, and ErrAuthorNotFound if the
+// fallback author does not exist or is soft-deleted. Books of a soft-deleted
+// author are not orphans here; OrphanBooksForDeletedAuthors handles those.
+func FixOrphanBooks(db *sqlx.DB, fallbackAuthorID *int) (int64, error) {
+	return InTxValue(db, func(tx *sqlx.Tx) (int64, error) {
+		if fallbackAuthorID != nil {
+			var exists bool
+			if err := tx.Get(&exists, "SELECT EXISTS(SELECT 1 FROM authors WHERE id=? AND deleted_at IS NULL)", *fallbackAuthorID); err != nil {
+				return 0, err
+			}
+			if !exists {
+				return 0, ErrAuthorNotFound
+			}
+		}
+		result, err := tx.Exec(`UPDATE books SET author_id=?
+			WHERE author_id IS NOT NULL AND author_id NOT IN (SELECT id FROM authors)`, fallbackAuthorID)
+		if err != nil {
+			return 0, err
+		}
+		return result.RowsAffected()
+	})
+}
+
+// BooksFromSameYear returns the other books published in the same year as
+// the given book, ordered by id. The result is empty if that book's year is
+// unknown. It returns sql.ErrNoRows if the book does not exist.
+func BooksFromSameYear(db *sqlx.DB, bookID int) ([]Book, error) {
+	var year sql.NullInt64
+	if err := db.Get(&year, "SELECT published_year FROM books WHERE id=?", bookID); err != nil {
+		return nil, err
+	}
+	books := []Book{}
+	if !year.Valid {
+		return books, nil
+	}
+	err := db.Select(&books, "SELECT * FROM books WHERE published_year=? AND id<>? ORDER BY id", year.Int64, bookID)
+	return books, err
+}
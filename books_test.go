@@ -0,0 +1,714 @@
+package main
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// bookGenre returns the stored genre of a book.
+func bookGenre(t *testing.T, db *sqlx.DB, id int64) sql.NullString {
+	t.Helper()
+	var genre sql.NullString
+	if err := db.Get(&genre, "SELECT genre FROM books WHERE id=?", id); err != nil {
+		t.Fatal(err)
+	}
+	return genre
+}
+
+func TestInsertBookDefaultGenre(t *testing.T) {
+	db := newTestDB(t)
+	t.Cleanup(func() { DefaultGenre = nil })
+
+	id, err := InsertBook(db, Book{Title: "No genre"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g := bookGenre(t, db, id); g.Valid {
+		t.Errorf("without a default, genre = %v, want NULL", g)
+	}
+
+	unknown := "Unknown"
+	DefaultGenre = &unknown
+	id, err = InsertBook(db, Book{Title: "No genre either"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g := bookGenre(t, db, id); g != nullString("Unknown") {
+		t.Errorf("with a default, genre = %v, want Unknown", g)
+	}
+
+	id, err = InsertBook(db, Book{Title: "Has genre", Genre: nullString("Horror")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g := bookGenre(t, db, id); g != nullString("Horror") {
+		t.Errorf("explicit genre = %v, want Horror", g)
+	}
+}
+
+// seedManyBooks inserts n books with every column filled in.
+func seedManyBooks(t testing.TB, db *sqlx.DB, n int) {
+	t.Helper()
+	err := InTx(db, func(tx *sqlx.Tx) error {
+		stmt, err := tx.Preparex("INSERT INTO books (title, author_id, published_year, genre, metadata, copies) VALUES (?, ?, ?, ?, ?, ?)")
+		if err != nil {
+			return err
+		}
+		defer stmt.Close()
+		for i := 0; i < n; i++ {
+			genre := sql.NullString{String: "Fantasy", Valid: i%3 != 0}
+			if _, err := stmt.Exec(fmt.Sprintf("Book %d", i), i%50+1, 1900+i%120, genre, Metadata{"isbn": fmt.Sprint(i)}, i%4+1); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSelectBooksFastMatchesSelect(t *testing.T) {
+	db := newTestDB(t)
+	seedManyBooks(t, db, 500)
+	db.MustExec("INSERT INTO books (title) VALUES ('All NULL')")
+	db.MustExec("UPDATE books SET updated_at=CURRENT_TIMESTAMP WHERE id % 7 = 0")
+
+	var want []Book
+	if err := db.Select(&want, "SELECT * FROM books ORDER BY id"); err != nil {
+		t.Fatal(err)
+	}
+	got, err := SelectBooksFast(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("SelectBooksFast returned %d books that differ from db.Select's %d", len(got), len(want))
+	}
+
+	empty := newTestDB(t)
+	got, err = SelectBooksFast(empty)
+	if err != nil || got == nil || len(got) != 0 {
+		t.Errorf("empty table: %#v, %v", got, err)
+	}
+}
+
+func BenchmarkSelectBooks(b *testing.B) {
+	db := newTestDB(b)
+	seedManyBooks(b, db, 10000)
+	b.Run("Select", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			var books []Book
+			if err := db.Select(&books, "SELECT * FROM books ORDER BY id"); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("Fast", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if _, err := SelectBooksFast(db); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func TestBooksByDecade(t *testing.T) {
+	db := newTestDB(t)
+	db.MustExec(`INSERT INTO books (title, published_year) VALUES
+		('a', 1996), ('b', 1997), ('c', 2000), ('d', 2009), ('e', 1850), ('f', NULL), ('g', 1990)`)
+	got, err := BooksByDecade(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []DecadeCount{{1850, 1}, {1990, 3}, {2000, 2}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("BooksByDecade = %v, want %v", got, want)
+	}
+}
+
+// genreCounts returns how many books have each genre, with NULL as "".
+func genreCounts(t *testing.T, db *sqlx.DB) map[string]int {
+	t.Helper()
+	var rows []struct {
+		Genre string `db:"genre"`
+		N     int    `db:"n"`
+	}
+	if err := db.Select(&rows, "SELECT COALESCE(genre, '') AS genre, COUNT(*) AS n FROM books GROUP BY genre"); err != nil {
+		t.Fatal(err)
+	}
+	counts := map[string]int{}
+	for _, r := range rows {
+		counts[r.Genre] = r.N
+	}
+	return counts
+}
+
+func TestRenameGenre(t *testing.T) {
+	db := newTestDB(t)
+	db.MustExec(`INSERT INTO books (title, genre) VALUES
+		('a', 'Fantasy'), ('b', 'Fantasy'), ('c', 'High Fantasy'), ('d', 'Horror'), ('e', NULL)`)
+	n, err := RenameGenre(db, "Fantasy", "High Fantasy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Errorf("renamed %d books, want 2", n)
+	}
+	want := map[string]int{"High Fantasy": 3, "Horror": 1, "": 1}
+	if got := genreCounts(t, db); !reflect.DeepEqual(got, want) {
+		t.Errorf("genres after rename = %v, want %v", got, want)
+	}
+	if n, err := RenameGenre(db, "Fantasy", "Other"); err != nil || n != 0 {
+		t.Errorf("renaming an unused genre: %d, %v", n, err)
+	}
+}
+
+func TestDistinctGenres(t *testing.T) {
+	db := newTestDB(t)
+	got, err := DistinctGenres(db)
+	if err != nil || got == nil || len(got) != 0 {
+		t.Errorf("no books: %#v, %v", got, err)
+	}
+	db.MustExec(`INSERT INTO books (title, genre) VALUES
+		('a', 'Horror'), ('b', 'Fantasy'), ('c', NULL), ('d', 'Horror'), ('e', 'Fantasy'), ('f', NULL)`)
+	got, err = DistinctGenres(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"Fantasy", "Horror"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("DistinctGenres = %q, want %q", got, want)
+	}
+}
+
+func TestTransferBook(t *testing.T) {
+	db := newTestDB(t)
+	db.MustExec("INSERT INTO authors (id, name, email) VALUES (1, 'Ann', 'ann@example.com'), (2, 'Bob', 'bob@example.com')")
+	db.MustExec("INSERT INTO books (id, title, author_id) VALUES (10, 'A', 1)")
+
+	if err := TransferBook(db, 10, 2); err != nil {
+		t.Fatal(err)
+	}
+	if n := count(t, db, "SELECT COUNT(*) FROM books WHERE id=10 AND author_id=2"); n != 1 {
+		t.Error("book was not transferred")
+	}
+	if err := TransferBook(db, 99, 2); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("missing book: %v, want sql.ErrNoRows", err)
+	}
+	if err := TransferBook(db, 10, 99); !errors.Is(err, ErrAuthorNotFound) {
+		t.Errorf("missing author: %v, want ErrAuthorNotFound", err)
+	}
+	if err := SoftDeleteAuthor(db, 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := TransferBook(db, 10, 1); !errors.Is(err, ErrAuthorNotFound) {
+		t.Errorf("deleted author: %v, want ErrAuthorNotFound", err)
+	}
+	if n := count(t, db, "SELECT COUNT(*) FROM books WHERE id=10 AND author_id=2"); n != 1 {
+		t.Error("failed transfer changed the book")
+	}
+}
+
+func TestBulkSetGenres(t *testing.T) {
+	db := newTestDB(t)
+	db.MustExec("INSERT INTO books (id, title, genre) VALUES (1, 'A', 'Drama'), (2, 'B', 'Drama'), (3, 'C', 'Drama')")
+	n, err := BulkSetGenres(db, map[int]string{1: "Fantasy", 3: "Horror", 99: "Mystery"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Errorf("updated %d books, want 2", n)
+	}
+	if got, want := genreCounts(t, db), map[string]int{"Fantasy": 1, "Drama": 1, "Horror": 1}; !reflect.DeepEqual(got, want) {
+		t.Errorf("genres = %v, want %v", got, want)
+	}
+	if n, err := BulkSetGenres(db, nil); n != 0 || err != nil {
+		t.Errorf("empty update: %d, %v", n, err)
+	}
+}
+
+func TestNeverBorrowedBooks(t *testing.T) {
+	db := newTestDB(t)
+	db.MustExec("INSERT INTO books (id, title) VALUES (1, 'On loan'), (2, 'Returned'), (3, 'Never')")
+	now := time.Now()
+	seedLoan(t, db, 1, 1, now, now, nil)
+	seedLoan(t, db, 2, 1, now, now, &now)
+	books, err := NeverBorrowedBooks(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(books) != 1 || books[0].ID != 3 {
+		t.Errorf("got %+v, want only book 3", books)
+	}
+}
+
+func TestDiffBooks(t *testing.T) {
+	old := Book{ID: 1, Title: "A", PublishedYear: nullInt64(1999), Copies: 1}
+	if got := DiffBooks(old, old); len(got) != 0 {
+		t.Errorf("identical books: %v", got)
+	}
+
+	renamed := old
+	renamed.Title = "B"
+	renamed.UpdatedAt = sql.NullTime{Time: time.Now(), Valid: true}
+	if got, want := DiffBooks(old, renamed), map[string]interface{}{"title": "B"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("renamed: %v, want %v", got, want)
+	}
+
+	withGenre := old
+	withGenre.Genre = nullString("Fantasy")
+	if got, want := DiffBooks(old, withGenre), map[string]interface{}{"genre": nullString("Fantasy")}; !reflect.DeepEqual(got, want) {
+		t.Errorf("genre set: %v, want %v", got, want)
+	}
+	if got, want := DiffBooks(withGenre, old), map[string]interface{}{"genre": sql.NullString{}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("genre unset: %v, want %v", got, want)
+	}
+
+	staleNull := old
+	staleNull.Genre = sql.NullString{String: "leftover"}
+	staleNull.AuthorID = sql.NullInt64{Int64: 7}
+	if got := DiffBooks(old, staleNull); len(got) != 0 {
+		t.Errorf("NULLs with different unused fields: %v", got)
+	}
+}
+
+func TestAutocompleteTitles(t *testing.T) {
+	db := newTestDB(t)
+	db.MustExec(`INSERT INTO books (title) VALUES ('Harry Potter 2'), ('Harry Potter 1'), ('Harry Potter 1'),
+		('Hamlet'), ('100% Cotton'), ('100 Cats'), ('a_b'), ('axb')`)
+	tests := []struct {
+		prefix string
+		limit  int
+		want   []string
+	}{
+		{"Harry", 10, []string{"Harry Potter 1", "Harry Potter 2"}},
+		{"Harry", 1, []string{"Harry Potter 1"}},
+		{"100%", 10, []string{"100% Cotton"}},
+		{"a_", 10, []string{"a_b"}},
+		{"", 2, []string{"100 Cats", "100% Cotton"}},
+		{"Zzz", 10, []string{}},
+	}
+	for _, tt := range tests {
+		got, err := AutocompleteTitles(db, tt.prefix, tt.limit)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("AutocompleteTitles(%q, %d) = %q, want %q", tt.prefix, tt.limit, got, tt.want)
+		}
+	}
+}
+
+func TestCloneBook(t *testing.T) {
+	db := newTestDB(t)
+	db.MustExec(`INSERT INTO books (id, title, author_id, published_year, genre, metadata, copies)
+		VALUES (1, 'Dune', 4, 1965, NULL, '{"isbn":"x"}', 3)`)
+	id, err := CloneBook(db, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var orig, clone Book
+	if err := db.Get(&orig, "SELECT * FROM books WHERE id=1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Get(&clone, "SELECT * FROM books WHERE id=?", id); err != nil {
+		t.Fatal(err)
+	}
+	if clone.Title != "Dune (Copy)" {
+		t.Errorf("clone title = %q", clone.Title)
+	}
+	clone.ID, clone.Title = orig.ID, orig.Title
+	if !reflect.DeepEqual(clone, orig) {
+		t.Errorf("clone = %+v, want %+v", clone, orig)
+	}
+	if _, err := CloneBook(db, 99); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("missing book: %v, want sql.ErrNoRows", err)
+	}
+}
+
+// setClock makes the book validation clock return now for the rest of the
+// test.
+func setClock(t *testing.T, now time.Time) {
+	old := clock
+	clock = func() time.Time { return now }
+	t.Cleanup(func() { clock = old })
+}
+
+func TestValidateYear(t *testing.T) {
+	now := time.Date(2024, 12, 31, 23, 0, 0, 0, time.UTC)
+	tests := []struct {
+		year sql.NullInt64
+		ok   bool
+	}{
+		{sql.NullInt64{}, true},
+		{nullInt64(1999), true},
+		{nullInt64(2024), true},
+		{nullInt64(2025), false},
+	}
+	for _, tt := range tests {
+		err := Book{PublishedYear: tt.year}.ValidateYear(now)
+		if tt.ok && err != nil || !tt.ok && !errors.Is(err, ErrFutureYear) {
+			t.Errorf("year %v: %v", tt.year, err)
+		}
+	}
+}
+
+// yearValuer is a driver.Valuer other than the sql.Null types.
+type yearValuer int
+
+func (y yearValuer) Value() (driver.Value, error) { return int64(y), nil }
+
+func TestUpdateBookFieldsYear(t *testing.T) {
+	db := newTestDB(t)
+	setClock(t, time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC))
+	db.MustExec("INSERT INTO books (id, title, published_year) VALUES (1, 'A', 1999)")
+
+	for _, year := range []interface{}{3000, int64(3000), int32(3000), uint16(3000), nullInt64(3000), yearValuer(3000)} {
+		if err := UpdateBookFields(db, 1, map[string]interface{}{"published_year": year}); !errors.Is(err, ErrFutureYear) {
+			t.Errorf("%T(3000): %v, want ErrFutureYear", year, err)
+		}
+	}
+	for _, year := range []interface{}{"soon", 2000.5, time.Now()} {
+		if err := UpdateBookFields(db, 1, map[string]interface{}{"published_year": year}); err == nil {
+			t.Errorf("%T %v accepted", year, year)
+		}
+	}
+	if n := count(t, db, "SELECT COUNT(*) FROM books WHERE published_year=1999"); n != 1 {
+		t.Fatal("rejected year was written")
+	}
+
+	for _, year := range []interface{}{int64(2001), yearValuer(2002), sql.NullInt64{}, nil} {
+		if err := UpdateBookFields(db, 1, map[string]interface{}{"published_year": year}); err != nil {
+			t.Errorf("%T %v: %v", year, year, err)
+		}
+	}
+	if n := count(t, db, "SELECT COUNT(*) FROM books WHERE published_year IS NULL"); n != 1 {
+		t.Error("NULL year not written")
+	}
+}
+
+func TestBookWithAvailability(t *testing.T) {
+	db := newTestDB(t)
+	db.MustExec("INSERT INTO books (id, title, copies) VALUES (1, 'Single', 1), (2, 'Pair', 2)")
+	now := time.Now()
+	seedLoan(t, db, 1, 1, now, now, nil)
+	seedLoan(t, db, 2, 1, now, now, nil)
+	seedLoan(t, db, 2, 2, now, now, &now)
+
+	for id, want := range map[int]bool{1: false, 2: true} {
+		b, err := BookWithAvailability(db, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if b.ID != id || b.Available != want {
+			t.Errorf("book %d: %+v, want available=%v", id, b, want)
+		}
+	}
+	if _, err := BookWithAvailability(db, 99); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("missing book: %v, want sql.ErrNoRows", err)
+	}
+}
+
+func TestBooksWithUnknownYear(t *testing.T) {
+	db := newTestDB(t)
+	setClock(t, time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC))
+	db.MustExec("INSERT INTO books (id, title, published_year) VALUES (1, 'A', NULL), (2, 'B', 1999), (3, 'C', NULL)")
+	books, err := BooksWithUnknownYear(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(books) != 2 || books[0].ID != 1 || books[1].ID != 3 {
+		t.Fatalf("unknown year books = %+v, want 1 and 3", books)
+	}
+
+	if err := SetBookYear(db, 1, 2001); err != nil {
+		t.Fatal(err)
+	}
+	if err := SetBookYear(db, 3, 2025); !errors.Is(err, ErrFutureYear) {
+		t.Errorf("future year: %v, want ErrFutureYear", err)
+	}
+	if err := SetBookYear(db, 99, 2001); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("missing book: %v, want sql.ErrNoRows", err)
+	}
+	if books, _ = BooksWithUnknownYear(db); len(books) != 1 || books[0].ID != 3 {
+		t.Errorf("after SetBookYear: %+v, want only book 3", books)
+	}
+}
+
+func TestBooksByIDMap(t *testing.T) {
+	db := newTestDB(t)
+	db.MustExec("INSERT INTO books (id, title) VALUES (1, 'A'), (2, 'B'), (3, 'C')")
+	byID, err := BooksByIDMap(db, []int{3, 1, 99, 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(byID) != 2 || byID[1].Title != "A" || byID[3].Title != "C" {
+		t.Errorf("BooksByIDMap = %+v, want books 1 and 3", byID)
+	}
+	if byID, err := BooksByIDMap(db, nil); err != nil || byID == nil || len(byID) != 0 {
+		t.Errorf("no ids: %v, %v, want an empty map", byID, err)
+	}
+}
+
+func TestBooksUpdatedSince(t *testing.T) {
+	db := newTestDB(t)
+	db.MustExec("INSERT INTO books (id, title) VALUES (1, 'A'), (2, 'B'), (3, 'C')")
+	db.MustExec("UPDATE books SET updated_at='2024-01-01 10:00:00' WHERE id=1")
+
+	before := time.Now().UTC().Truncate(time.Second)
+	if err := UpdateBookFields(db, 3, map[string]interface{}{"title": "C2"}); err != nil {
+		t.Fatal(err)
+	}
+	var b Book
+	if err := db.Get(&b, "SELECT * FROM books WHERE id=3"); err != nil {
+		t.Fatal(err)
+	}
+	if !b.UpdatedAt.Valid || b.UpdatedAt.Time.Before(before) {
+		t.Errorf("updated_at = %v, want at or after %v", b.UpdatedAt, before)
+	}
+
+	books, err := BooksUpdatedSince(db, time.Date(2024, 1, 1, 10, 0, 0, 500, time.UTC))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(books) != 2 || books[0].ID != 1 || books[1].ID != 3 {
+		t.Errorf("updated since 2024: %+v, want books 1 then 3", books)
+	}
+	if books, _ = BooksUpdatedSince(db, before); len(books) != 1 || books[0].ID != 3 {
+		t.Errorf("updated since %v: %+v, want only book 3", before, books)
+	}
+}
+
+func TestListBooksSorted(t *testing.T) {
+	db := newTestDB(t)
+	db.MustExec(`INSERT INTO books (id, title, published_year) VALUES
+		(1, 'A', 2001), (2, 'B', NULL), (3, 'C', 1990), (4, 'D', NULL), (5, 'E', 2001)`)
+	ids := func(nullsFirst bool) []int {
+		t.Helper()
+		books, err := ListBooksSorted(db, "published_year", nullsFirst)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var ids []int
+		for _, b := range books {
+			ids = append(ids, b.ID)
+		}
+		return ids
+	}
+	if got, want := ids(true), []int{2, 4, 3, 1, 5}; !reflect.DeepEqual(got, want) {
+		t.Errorf("nulls first = %v, want %v", got, want)
+	}
+	if got, want := ids(false), []int{3, 1, 5, 2, 4}; !reflect.DeepEqual(got, want) {
+		t.Errorf("nulls last = %v, want %v", got, want)
+	}
+	if _, err := ListBooksSorted(db, "id; DROP TABLE books", false); err == nil {
+		t.Error("unknown sort column accepted")
+	}
+}
+
+func TestNormalizeGenre(t *testing.T) {
+	tests := []struct {
+		in    string
+		want  string
+		known bool
+	}{
+		{"  sci fi", "Sci-Fi", true},
+		{"SCIFI", "Sci-Fi", true},
+		{"science_fiction", "Sci-Fi", true},
+		{"non-fiction", "Non-Fiction", true},
+		{"Crime", "Mystery", true},
+		{"  Steampunk ", "Steampunk", false},
+		{"   ", "", false},
+	}
+	for _, tt := range tests {
+		got, known := NormalizeGenre(tt.in)
+		if got != tt.want || known != tt.known {
+			t.Errorf("NormalizeGenre(%q) = %q, %v, want %q, %v", tt.in, got, known, tt.want, tt.known)
+		}
+	}
+}
+
+func TestInsertBookNormalizesGenre(t *testing.T) {
+	db := newTestDB(t)
+	for _, g := range []string{"sci fi", "SF", " "} {
+		if _, err := InsertBook(db, Book{Title: g, Genre: nullString(g)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got, want := genreCounts(t, db), map[string]int{"Sci-Fi": 2, "": 1}; !reflect.DeepEqual(got, want) {
+		t.Errorf("stored genres = %v, want %v", got, want)
+	}
+}
+
+func TestBookByISBN(t *testing.T) {
+	db := newTestDB(t)
+	db.MustExec(`INSERT INTO books (id, title, metadata) VALUES
+		(1, 'A', '{"isbn":"111"}'), (2, 'B', '{"isbn":"222","tags":["x"]}'), (3, 'C', '{"isbn":"222"}'), (4, 'D', NULL)`)
+	b, err := BookByISBN(db, "222")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.ID != 2 || b.Metadata["isbn"] != "222" {
+		t.Errorf("BookByISBN(222) = %+v, want book 2", b)
+	}
+	if _, err := BookByISBN(db, "999"); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("unknown isbn: %v, want sql.ErrNoRows", err)
+	}
+}
+
+func TestDistinctYears(t *testing.T) {
+	db := newTestDB(t)
+	if years, err := DistinctYears(db); err != nil || years == nil || len(years) != 0 {
+		t.Errorf("no books: %#v, %v, want empty slice", years, err)
+	}
+	db.MustExec("INSERT INTO books (title, published_year) VALUES ('A', 1999), ('B', 2005), ('C', NULL), ('D', 1999), ('E', 1850)")
+	years, err := DistinctYears(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []int{2005, 1999, 1850}; !reflect.DeepEqual(years, want) {
+		t.Errorf("years = %v, want %v", years, want)
+	}
+}
+
+func TestOldestBook(t *testing.T) {
+	db := newTestDB(t)
+	db.MustExec("INSERT INTO books (id, title, published_year) VALUES (1, 'Unknown', NULL)")
+	if _, err := OldestBook(db); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("no known years: %v, want sql.ErrNoRows", err)
+	}
+	db.MustExec("INSERT INTO books (id, title, published_year) VALUES (2, 'New', 2001), (3, 'Old', 1813), (4, 'Also old', 1813)")
+	b, err := OldestBook(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.ID != 3 {
+		t.Errorf("oldest book = %+v, want book 3", b)
+	}
+}
+
+func TestRandomBooks(t *testing.T) {
+	db := newTestDB(t)
+	seedManyBooks(t, db, 150)
+	books, err := RandomBooks(db, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	seen := map[int]bool{}
+	for _, b := range books {
+		seen[b.ID] = true
+	}
+	if len(books) != 10 || len(seen) != 10 {
+		t.Errorf("got %d books, %d distinct, want 10", len(books), len(seen))
+	}
+	if books, _ := RandomBooks(db, 1000); len(books) != 100 {
+		t.Errorf("n above the cap: %d books, want 100", len(books))
+	}
+	if books, err := RandomBooks(db, -1); err != nil || books == nil || len(books) != 0 {
+		t.Errorf("negative n: %#v, %v, want empty slice", books, err)
+	}
+}
+
+func TestCatalogView(t *testing.T) {
+	db := newTestDB(t)
+	db.MustExec("INSERT INTO authors (id, name, email) VALUES (1, 'Ann', 'ann@example.com'), (2, 'Gone', 'gone@example.com')")
+	db.MustExec(`INSERT INTO books (id, title, author_id, copies) VALUES
+		(1, 'Beta', 1, 1), (2, 'Alpha', 1, 2), (3, 'Alpha', NULL, 1), (4, 'Gamma', 99, 1), (5, 'Delta', 2, 1)`)
+	if err := SoftDeleteAuthor(db, 2); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	seedLoan(t, db, 1, 1, now, now, nil)
+	seedLoan(t, db, 2, 1, now, now, nil)
+	seedLoan(t, db, 4, 1, now, now, &now)
+
+	rows, err := CatalogView(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []CatalogRow{
+		{2, "Alpha", "Ann", true},
+		{3, "Alpha", "", true},
+		{1, "Beta", "Ann", false},
+		{5, "Delta", "", true},
+		{4, "Gamma", "", true},
+	}
+	if !reflect.DeepEqual(rows, want) {
+		t.Errorf("catalog = %+v, want %+v", rows, want)
+	}
+}
+
+func TestFixOrphanBooks(t *testing.T) {
+	seed := func(t *testing.T) *sqlx.DB {
+		db := newTestDB(t)
+		db.MustExec("INSERT INTO authors (id, name, email) VALUES (1, 'Ann', 'ann@example.com'), (2, 'Unknown', 'unknown@example.com')")
+		db.MustExec("INSERT INTO books (id, title, author_id) VALUES (1, 'Fine', 1), (2, 'Orphan', 98), (3, 'Orphan', 99), (4, 'None', NULL)")
+		return db
+	}
+
+	db := seed(t)
+	fallback := 2
+	n, err := FixOrphanBooks(db, &fallback)
+	if err != nil || n != 2 {
+		t.Fatalf("with fallback: %d, %v, want 2", n, err)
+	}
+	if got := count(t, db, "SELECT COUNT(*) FROM books WHERE author_id=2"); got != 2 {
+		t.Errorf("%d books moved to the fallback, want 2", got)
+	}
+
+	db = seed(t)
+	if n, err := FixOrphanBooks(db, nil); err != nil || n != 2 {
+		t.Fatalf("without fallback: %d, %v, want 2", n, err)
+	}
+	if got := count(t, db, "SELECT COUNT(*) FROM books WHERE author_id IS NULL"); got != 3 {
+		t.Errorf("%d books without author, want 3", got)
+	}
+
+	db = seed(t)
+	missing := 50
+	if _, err := FixOrphanBooks(db, &missing); !errors.Is(err, ErrAuthorNotFound) {
+		t.Errorf("missing fallback: %v, want ErrAuthorNotFound", err)
+	}
+	if got := count(t, db, "SELECT COUNT(*) FROM books WHERE author_id IN (98, 99)"); got != 2 {
+		t.Error("books changed despite a missing fallback")
+	}
+
+	db = seed(t)
+	if err := SoftDeleteAuthor(db, 2); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := FixOrphanBooks(db, &fallback); !errors.Is(err, ErrAuthorNotFound) {
+		t.Errorf("deleted fallback: %v, want ErrAuthorNotFound", err)
+	}
+}
+
+func TestBooksFromSameYear(t *testing.T) {
+	db := newTestDB(t)
+	db.MustExec(`INSERT INTO books (id, title, published_year) VALUES
+		(1, 'A', 1999), (2, 'B', 2000), (3, 'C', 1999), (4, 'D', NULL), (5, 'E', NULL), (6, 'F', 1999)`)
+	books, err := BooksFromSameYear(db, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(books) != 2 || books[0].ID != 1 || books[1].ID != 6 {
+		t.Errorf("same year as 3: %+v, want 1 and 6", books)
+	}
+	if books, err := BooksFromSameYear(db, 2); err != nil || books == nil || len(books) != 0 {
+		t.Errorf("only book of its year: %#v, %v, want empty slice", books, err)
+	}
+	if books, err := BooksFromSameYear(db, 4); err != nil || books == nil || len(books) != 0 {
+		t.Errorf("unknown year: %#v, %v, want empty slice", books, err)
+	}
+	if _, err := BooksFromSameYear(db, 99); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("missing book: %v, want sql.ErrNoRows", err)
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// copyBatchParams caps the bound parameters in each multi-row INSERT issued
+// by CopyTable, staying under SQLite's default variable limit.
+const copyBatchParams = 900
+
+// CopyTable copies every row of table from src to dst, which must already
+// have the table with the same columns. Rows are streamed from src and
+// inserted into dst in multi-row batches within one transaction, so a
+// failure leaves dst unchanged. It returns the number of rows copied.
+func CopyTable(src, dst *sqlx.DB, table string) (int64, error) {
+	if err := checkTable(table); err != nil {
+		return 0, err
+	}
+	rows, err := src.Queryx("SELECT * FROM " + table)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+	columns, err := rows.Columns()
+	if err != nil {
+		return 0, err
+	}
+	batchRows := copyBatchParams / len(columns)
+	if batchRows < 1 {
+		batchRows = 1
+	}
+	rowPlaceholders := "(?" + strings.Repeat(", ?", len(columns)-1) + ")"
+	insert := "INSERT INTO " + table + " (" + strings.Join(columns, ", ") + ") VALUES "
+
+	return InTxValue(dst, func(tx *sqlx.Tx) (int64, error) {
+		var copied int64
+		batch := make([]interface{}, 0, batchRows*len(columns))
+		flush := func() error {
+			n := len(batch) / len(columns)
+			if n == 0 {
+				return nil
+			}
+			query := insert + rowPlaceholders + strings.Repeat(", "+rowPlaceholders, n-1)
+			if _, err := tx.Exec(query, batch...); err != nil {
+				return err
+			}
+			copied += int64(n)
+			batch = batch[:0]
+			return nil
+		}
+		for rows.Next() {
+			values, err := rows.SliceScan()
+			if err != nil {
+				return 0, err
+			}
+			batch = append(batch, values...)
+			if len(batch) == batchRows*len(columns) {
+				if err := flush(); err != nil {
+					return 0, err
+				}
+			}
+		}
+		if err := rows.Err(); err != nil {
+			return 0, err
+		}
+		if err := flush(); err != nil {
+			return 0, err
+		}
+		return copied, nil
+	})
+}
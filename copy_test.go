@@ -0,0 +1,43 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCopyTable(t *testing.T) {
+	src, dst := newTestDB(t), newTestDB(t)
+	seedManyBooks(t, src, 1000)
+	n, err := CopyTable(src, dst, "books")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1000 {
+		t.Errorf("copied %d rows, want 1000", n)
+	}
+	var want, got []Book
+	if err := src.Select(&want, "SELECT * FROM books ORDER BY id"); err != nil {
+		t.Fatal(err)
+	}
+	if err := dst.Select(&got, "SELECT * FROM books ORDER BY id"); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Error("copied rows differ from the source")
+	}
+}
+
+func TestCopyTableFailureLeavesDestination(t *testing.T) {
+	src, dst := newTestDB(t), newTestDB(t)
+	seedManyBooks(t, src, 300)
+	dst.MustExec("INSERT INTO books (id, title) VALUES (250, 'Conflict')")
+	if _, err := CopyTable(src, dst, "books"); err == nil {
+		t.Fatal("primary key conflict not reported")
+	}
+	if n := count(t, dst, "SELECT COUNT(*) FROM books"); n != 1 {
+		t.Errorf("destination has %d books after failed copy, want 1", n)
+	}
+	if _, err := CopyTable(src, dst, "books; DROP TABLE books"); err == nil {
+		t.Error("unknown table accepted")
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// dbOptions collects the settings applied by OpenDB.
+type dbOptions struct {
+	wal bool
+}
+
+// Option configures OpenDB.
+type Option func(*dbOptions)
+
+// WithWAL switches the database to write-ahead logging, which lets readers
+// proceed while a write is in progress. The setting is stored in the
+// database file, so it does not apply to in-memory databases.
+func WithWAL() Option {
+	return func(o *dbOptions) { o.wal = true }
+}
+
+// OpenDB connects to the SQLite database at dsn and applies opts.
+func OpenDB(dsn string, opts ...Option) (*sqlx.DB, error) {
+	var o dbOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	db, err := sqlx.Connect("sqlite3", dsn)
+	if err != nil {
+		return nil, err
+	}
+	if o.wal {
+		var mode string
+		if err := db.Get(&mode, "PRAGMA journal_mode=WAL"); err != nil {
+			db.Close()
+			return nil, err
+		}
+		if mode != "wal" {
+			db.Close()
+			return nil, fmt.Errorf("enable WAL: journal mode is %q", mode)
+		}
+	}
+	return db, nil
+}
+
+// ConnectWithRetry calls sqlx.Connect up to attempts times, waiting delay
+// after the first failure and doubling the wait after each further one. It
+// returns the last error if every attempt fails.
+func ConnectWithRetry(driver, dsn string, attempts int, delay time.Duration) (*sqlx.DB, error) {
+	if attempts < 1 {
+		attempts = 1
+	}
+	var err error
+	for i := 0; i < attempts; i++ {
+		if i > 0 {
+			time.Sleep(delay)
+			delay *= 2
+		}
+		var db *sqlx.DB
+		if db, err = sqlx.Connect(driver, dsn); err == nil {
+			return db, nil
+		}
+	}
+	return nil, fmt.Errorf("connect after %d attempts: %w", attempts, err)
+}
+
+// OpenReadOnly opens the SQLite database at dsn with mode=ro, for example on
+// a replica. Reads work as usual, but any write (Exec of INSERT, UPDATE,
+// DELETE or DDL) fails with "attempt to write a readonly database".
+func OpenReadOnly(dsn string) (*sqlx.DB, error) {
+	if !strings.HasPrefix(dsn, "file:") {
+		dsn = "file:" + dsn
+	}
+	sep := "?"
+	if strings.Contains(dsn, "?") {
+		sep = "&"
+	}
+	return sqlx.Connect("sqlite3", dsn+sep+"mode=ro")
+}
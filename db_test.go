@@ -0,0 +1,127 @@
+package main
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// flakyDriver is the sqlite3 driver, except that connecting fails until
+// failures reaches zero.
+type flakyDriver struct {
+	mu       sync.Mutex
+	failures int
+	attempts int
+}
+
+func (d *flakyDriver) Open(dsn string) (driver.Conn, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.attempts++
+	if d.failures > 0 {
+		d.failures--
+		return nil, errors.New("database not ready")
+	}
+	return (&sqlite3.SQLiteDriver{}).Open(dsn)
+}
+
+var flaky = &flakyDriver{}
+
+func init() {
+	sql.Register("flaky-sqlite3", flaky)
+}
+
+func TestConnectWithRetryFirstTry(t *testing.T) {
+	db, err := ConnectWithRetry("sqlite3", filepath.Join(t.TempDir(), "test.db"), 3, time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+}
+
+func TestConnectWithRetryFlaky(t *testing.T) {
+	flaky.mu.Lock()
+	flaky.failures, flaky.attempts = 2, 0
+	flaky.mu.Unlock()
+
+	db, err := ConnectWithRetry("flaky-sqlite3", filepath.Join(t.TempDir(), "test.db"), 5, time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if flaky.attempts != 3 {
+		t.Errorf("connected after %d attempts, want 3", flaky.attempts)
+	}
+}
+
+func TestConnectWithRetryGivesUp(t *testing.T) {
+	flaky.mu.Lock()
+	flaky.failures, flaky.attempts = 10, 0
+	flaky.mu.Unlock()
+
+	_, err := ConnectWithRetry("flaky-sqlite3", filepath.Join(t.TempDir(), "test.db"), 3, time.Millisecond)
+	if err == nil {
+		t.Fatal("want an error after every attempt fails")
+	}
+	if flaky.attempts != 3 {
+		t.Errorf("made %d attempts, want 3", flaky.attempts)
+	}
+}
+
+func TestOpenReadOnly(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "library.db")
+	rw, err := OpenDB(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Migrate(rw); err != nil {
+		t.Fatal(err)
+	}
+	rw.MustExec("INSERT INTO authors (name, email) VALUES ('Ann', 'ann@example.com')")
+	rw.Close()
+
+	ro, err := OpenReadOnly(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ro.Close()
+	var n int
+	if err := ro.Get(&n, "SELECT COUNT(*) FROM authors"); err != nil || n != 1 {
+		t.Fatalf("read: %d, %v", n, err)
+	}
+	_, err = ro.Exec("INSERT INTO authors (name, email) VALUES ('Bob', 'bob@example.com')")
+	if err == nil || !strings.Contains(err.Error(), "readonly") {
+		t.Errorf("insert on read-only database: %v, want readonly error", err)
+	}
+}
+
+func TestOpenDBWithWAL(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "library.db")
+	db, err := OpenDB(path, WithWAL())
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	// The journal mode persists in the file, so a plain open sees it.
+	db, err = OpenDB(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	var mode string
+	if err := db.Get(&mode, "PRAGMA journal_mode"); err != nil || mode != "wal" {
+		t.Errorf("journal mode = %q, %v, want wal", mode, err)
+	}
+
+	if _, err := OpenDB(":memory:", WithWAL()); err == nil {
+		t.Error("WAL accepted for an in-memory database")
+	}
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"errors"
+	"net/mail"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+var (
+	// ErrInvalidEmail is returned when an email address cannot be parsed.
+	ErrInvalidEmail = errors.New("invalid email")
+	// ErrDuplicateEmail is returned when an email address is already taken.
+	ErrDuplicateEmail = errors.New("email already in use")
+	// ErrAuthorNotFound is returned when a referenced author does not exist.
+	ErrAuthorNotFound = errors.New("author not found")
+)
+
+// ValidateEmail returns ErrInvalidEmail unless email is a bare address such
+// as "name@example.com".
+func ValidateEmail(email string) error {
+	addr, err := mail.ParseAddress(email)
+	if err != nil || addr.Address != email {
+		return ErrInvalidEmail
+	}
+	return nil
+}
+
+// isUniqueViolation reports whether err is a SQLite UNIQUE constraint error.
+func isUniqueViolation(err error) bool {
+	var sqliteErr sqlite3.Error
+	return errors.As(err, &sqliteErr) && sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// ErrNotSelect is returned by Explain for statements other than queries.
+var ErrNotSelect = errors.New("only SELECT statements can be explained")
+
+// planStep is one row of SQLite's EXPLAIN QUERY PLAN output.
+type planStep struct {
+	ID      int    `db:"id"`
+	Parent  int    `db:"parent"`
+	NotUsed int    `db:"notused"`
+	Detail  string `db:"detail"`
+}
+
+// queryPlan runs EXPLAIN QUERY PLAN for query and returns the raw steps.
+// go-sqlite3 runs every statement in a query string, and only the first
+// would be explained, so a semicolon anywhere but at the very end is
+// rejected, even inside a string literal.
+func queryPlan(db *sqlx.DB, query string, args ...interface{}) ([]planStep, error) {
+	trimmed := strings.ToUpper(strings.TrimSpace(query))
+	if !strings.HasPrefix(trimmed, "SELECT") && !strings.HasPrefix(trimmed, "WITH") {
+		return nil, ErrNotSelect
+	}
+	if strings.Contains(strings.TrimSuffix(trimmed, ";"), ";") {
+		return nil, fmt.Errorf("%w: query holds more than one statement", ErrNotSelect)
+	}
+	var steps []planStep
+	err := db.Select(&steps, "EXPLAIN QUERY PLAN "+query, args...)
+	return steps, err
+}
+
+// Explain returns SQLite's query plan for a SELECT statement, one step per
+// line and indented to show nesting. Other statements, and query strings
+// holding more than one statement, are rejected with ErrNotSelect so that
+// EXPLAIN never runs against a write.
+func Explain(db *sqlx.DB, query string, args ...interface{}) (string, error) {
+	steps, err := queryPlan(db, query, args...)
+	if err != nil {
+		return "", err
+	}
+	depth := map[int]int{}
+	var b strings.Builder
+	for _, s := range steps {
+		d := 0
+		if s.Parent != 0 {
+			d = depth[s.Parent] + 1
+		}
+		depth[s.ID] = d
+		b.WriteString(strings.Repeat("  ", d))
+		b.WriteString(s.Detail)
+		b.WriteString("\n")
+	}
+	return b.String(), nil
+}
+
+// indexChecks are the standard lookups audited by SuggestIndexes, with the
+// column that would serve each of them.
+var indexChecks = []struct {
+	table, column, query string
+}{
+	{"books", "author_id", "SELECT * FROM books WHERE author_id=0"},
+	{"members", "email", "SELECT * FROM members WHERE email=''"},
+	{"loans", "return_date", "SELECT * FROM loans WHERE return_date IS NULL"},
+}
+
+// SuggestIndexes explains each of the standard lookups and returns a
+// CREATE INDEX statement for every one that needs a full table scan. An
+// empty result means all of them can use an index.
+func SuggestIndexes(db *sqlx.DB) ([]string, error) {
+	suggestions := []string{}
+	for _, c := range indexChecks {
+		steps, err := queryPlan(db, c.query)
+		if err != nil {
+			return nil, err
+		}
+		for _, s := range steps {
+			if s.Detail == "SCAN "+c.table {
+				suggestions = append(suggestions,
+					"CREATE INDEX idx_"+c.table+"_"+c.column+" ON "+c.table+"("+c.column+");")
+				break
+			}
+		}
+	}
+	return suggestions, nil
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestExplainJoin(t *testing.T) {
+	db := newTestDB(t)
+	plan, err := Explain(db, `SELECT books.title, authors.name FROM books
+		JOIN authors ON authors.id = books.author_id WHERE authors.email = ?`, "a@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"books", "authors", "sqlite_autoindex_authors"} {
+		if !strings.Contains(plan, want) {
+			t.Errorf("plan does not mention %s:\n%s", want, plan)
+		}
+	}
+}
+
+func TestExplainRejectsWrites(t *testing.T) {
+	db := newTestDB(t)
+	db.MustExec("INSERT INTO books (title) VALUES ('Kept')")
+	for _, q := range []string{"DELETE FROM books", " update books SET title='x'", "DROP TABLE books",
+		"SELECT 1; DELETE FROM books", "SELECT 1;DELETE FROM books;", "WITH x AS (SELECT 1) SELECT * FROM x; DROP TABLE books"} {
+		if _, err := Explain(db, q); !errors.Is(err, ErrNotSelect) {
+			t.Errorf("Explain(%q) = %v, want ErrNotSelect", q, err)
+		}
+	}
+	if n := count(t, db, "SELECT COUNT(*) FROM sqlite_master WHERE name='books'"); n != 1 {
+		t.Error("books table is gone")
+	}
+	if n := count(t, db, "SELECT COUNT(*) FROM books"); n != 1 {
+		t.Errorf("%d books left, want 1", n)
+	}
+	if _, err := Explain(db, "SELECT * FROM books;"); err != nil {
+		t.Errorf("trailing semicolon: %v", err)
+	}
+}
+
+func TestSuggestIndexes(t *testing.T) {
+	db := newTestDB(t)
+	db.MustExec("DROP INDEX idx_loans_active_book")
+	suggestions, err := SuggestIndexes(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"CREATE INDEX idx_books_author_id ON books(author_id);",
+		"CREATE INDEX idx_loans_return_date ON loans(return_date);",
+	}
+	if !reflect.DeepEqual(suggestions, want) {
+		t.Errorf("suggestions = %q, want %q", suggestions, want)
+	}
+	for _, s := range suggestions {
+		db.MustExec(s)
+	}
+	if suggestions, err = SuggestIndexes(db); err != nil || len(suggestions) != 0 {
+		t.Errorf("after adding indexes: %q, %v", suggestions, err)
+	}
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"encoding/csv"
+	"io"
+	"strconv"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// ExportMembersCSV writes all members to w as CSV, ordered by id, starting
+// with an id,name,email,join_date header. Fields containing commas, quotes
+// or newlines are quoted.
+func ExportMembersCSV(db *sqlx.DB, w io.Writer) error {
+	rows, err := db.Queryx("SELECT * FROM members ORDER BY id")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	cw := csv.NewWriter(w)
+	if err := cw.Write([]string{"id", "name", "email", "join_date"}); err != nil {
+		return err
+	}
+	for rows.Next() {
+		var m Member
+		if err := rows.StructScan(&m); err != nil {
+			return err
+		}
+		if err := cw.Write([]string{strconv.Itoa(m.ID), m.Name, m.Email, m.JoinDate}); err != nil {
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	cw.Flush()
+	return cw.Error()
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"reflect"
+	"testing"
+)
+
+func TestExportMembersCSV(t *testing.T) {
+	db := newTestDB(t)
+	db.MustExec(`INSERT INTO members (id, name, email, join_date) VALUES
+		(1, 'Doe, John', 'john@example.com', '2024-01-02'),
+		(2, 'Jane "JJ" Roe', 'jane@example.com', '2024-02-03')`)
+	var buf bytes.Buffer
+	if err := ExportMembersCSV(db, &buf); err != nil {
+		t.Fatal(err)
+	}
+	records, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [][]string{
+		{"id", "name", "email", "join_date"},
+		{"1", "Doe, John", "john@example.com", "2024-01-02"},
+		{"2", `Jane "JJ" Roe`, "jane@example.com", "2024-02-03"},
+	}
+	if !reflect.DeepEqual(records, want) {
+		t.Errorf("records = %q, want %q", records, want)
+	}
+}
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Cents is an amount of money in hundredths of the currency unit.
+type Cents int64
+
+func (c Cents) String() string {
+	sign := ""
+	if c < 0 {
+		sign, c = "-", -c
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, c/100, c%100)
+}
+
+// MemberFinesOwed returns the total of a member's unpaid fines, which is 0
+// for a member without any.
+func MemberFinesOwed(db *sqlx.DB, memberID int) (Cents, error) {
+	var owed Cents
+	err := db.Get(&owed, "SELECT COALESCE(SUM(amount), 0) FROM fines WHERE member_id=? AND paid_at IS NULL", memberID)
+	return owed, err
+}
@@ -0,0 +1,23 @@
+package main
+
+import "testing"
+
+func TestMemberFinesOwed(t *testing.T) {
+	db := newTestDB(t)
+	db.MustExec(`INSERT INTO fines (member_id, amount, paid_at) VALUES
+		(1, 250, NULL), (1, 100, CURRENT_TIMESTAMP), (1, 75, NULL), (2, 500, NULL)`)
+	if owed, err := MemberFinesOwed(db, 1); err != nil || owed != 325 {
+		t.Errorf("member 1 owes %v, %v, want 3.25", owed, err)
+	}
+	if owed, err := MemberFinesOwed(db, 3); err != nil || owed != 0 {
+		t.Errorf("member without fines owes %v, %v", owed, err)
+	}
+}
+
+func TestCentsString(t *testing.T) {
+	for c, want := range map[Cents]string{0: "0.00", 5: "0.05", 325: "3.25", -1050: "-10.50"} {
+		if got := c.String(); got != want {
+			t.Errorf("Cents(%d) = %q, want %q", int64(c), got, want)
+		}
+	}
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// ConflictMode controls what an import does with a row whose id already
+// exists.
+type ConflictMode int
+
+const (
+	// ConflictSkip keeps the existing row and ignores the imported one.
+	ConflictSkip ConflictMode = iota
+	// ConflictReplace overwrites the existing row with the imported one.
+	ConflictReplace
+	// ConflictError aborts the import and rolls it back.
+	ConflictError
+)
+
+// insertVerb returns the INSERT variant implementing the mode.
+func (m ConflictMode) insertVerb() (string, error) {
+	switch m {
+	case ConflictSkip:
+		return "INSERT OR IGNORE", nil
+	case ConflictReplace:
+		return "INSERT OR REPLACE", nil
+	case ConflictError:
+		return "INSERT", nil
+	}
+	return "", fmt.Errorf("unknown conflict mode %d", m)
+}
+
+// ImportBooks inserts books in a single transaction and returns how many rows
+// were written. Books with a zero ID get a new id; books with an ID that is
+// already taken are handled according to mode. Each book is checked and
+// normalized as by InsertBook, so a future published year rolls back the
+// whole import with ErrFutureYear.
+func ImportBooks(db *sqlx.DB, books []Book, mode ConflictMode) (int64, error) {
+	verb, err := mode.insertVerb()
+	if err != nil {
+		return 0, err
+	}
+	return InTxValue(db, func(tx *sqlx.Tx) (int64, error) {
+		var imported int64
+		for _, b := range books {
+			n, err := importBook(context.Background(), tx, verb, b)
+			if err != nil {
+				return 0, err
+			}
+			imported += n
+		}
+		return imported, nil
+	})
+}
+
+// importBook writes a single book using verb and returns the rows affected.
+func importBook(ctx context.Context, tx *sqlx.Tx, verb string, b Book) (int64, error) {
+	prepared, err := prepareBook(b)
+	if err != nil {
+		return 0, fmt.Errorf("book %q: %w", b.Title, err)
+	}
+	b = prepared
+	id := sql.NullInt64{Int64: int64(b.ID), Valid: b.ID != 0}
+	result, err := tx.ExecContext(ctx, verb+" INTO books (id, title, author_id, published_year, genre, metadata, copies) VALUES (?, ?, ?, ?, ?, ?, ?)",
+		id, b.Title, b.AuthorID, b.PublishedYear, b.Genre, b.Metadata, b.Copies)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// ImportBooksCSV reads books from CSV and imports them like ImportBooks. The
+// first record is a header naming the columns; title and author_id are
+// required, while id, published_year and genre are optional. An empty id
+// means a new book, and an empty author_id, published_year or genre is
+// stored as NULL.
+//
+// Rows are written as they are read, all in one transaction. Cancelling ctx
+// aborts the import and rolls back every row written so far, as does a
+// malformed record.
+func ImportBooksCSV(ctx context.Context, db *sqlx.DB, r io.Reader, mode ConflictMode) (int64, error) {
+	verb, err := mode.insertVerb()
+	if err != nil {
+		return 0, err
+	}
+	var imported int64
+	err = InTxContext(ctx, db, func(tx *sqlx.Tx) error {
+		return readBooksCSV(r, func(b Book) error {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			n, err := importBook(ctx, tx, verb, b)
+			imported += n
+			return err
+		})
+	})
+	if err != nil {
+		return 0, err
+	}
+	return imported, nil
+}
+
+// readBooksCSV parses the CSV format accepted by ImportBooksCSV, calling fn
+// with each book in turn. It stops at the first error from fn.
+func readBooksCSV(r io.Reader, fn func(Book) error) error {
+	cr := csv.NewReader(r)
+	header, err := cr.Read()
+	if err != nil {
+		return fmt.Errorf("reading header: %w", err)
+	}
+	cols := map[string]int{}
+	for i, name := range header {
+		cols[name] = i
+	}
+	for _, required := range []string{"title", "author_id"} {
+		if _, ok := cols[required]; !ok {
+			return fmt.Errorf("missing required column %q", required)
+		}
+	}
+	field := func(record []string, name string) string {
+		if i, ok := cols[name]; ok {
+			return record[i]
+		}
+		return ""
+	}
+	atoi := func(record []string, name string) (int, error) {
+		s := field(record, name)
+		if s == "" {
+			return 0, nil
+		}
+		n, err := strconv.Atoi(s)
+		if err != nil {
+			line, _ := cr.FieldPos(0)
+			return 0, fmt.Errorf("line %d: invalid %s %q", line, name, s)
+		}
+		return n, nil
+	}
+	nullInt := func(record []string, name string) (sql.NullInt64, error) {
+		if field(record, name) == "" {
+			return sql.NullInt64{}, nil
+		}
+		n, err := atoi(record, name)
+		return sql.NullInt64{Int64: int64(n), Valid: err == nil}, err
+	}
+
+	for {
+		record, err := cr.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		var b Book
+		if b.ID, err = atoi(record, "id"); err != nil {
+			return err
+		}
+		if b.AuthorID, err = nullInt(record, "author_id"); err != nil {
+			return err
+		}
+		if b.PublishedYear, err = nullInt(record, "published_year"); err != nil {
+			return err
+		}
+		b.Title = field(record, "title")
+		if genre := field(record, "genre"); genre != "" {
+			b.Genre = sql.NullString{String: genre, Valid: true}
+		}
+		if err := fn(b); err != nil {
+			return err
+		}
+	}
+}
+
+// ImportAuthorsWithBooks imports authors together with their books in a
+// single transaction. An author whose email matches an existing one,
+// ignoring case, is updated in place with the imported name, and restored if
+// it was soft-deleted; otherwise a new author is inserted. Each book is then inserted as by InsertBook with
+// its author_id set to that author, whatever it held before. Any invalid
+// email or book rolls back the whole import.
+func ImportAuthorsWithBooks(db *sqlx.DB, data []AuthorDetail) error {
+	return InTx(db, func(tx *sqlx.Tx) error {
+		for _, d := range data {
+			authorID, err := upsertAuthorByEmail(tx, d.Author)
+			if err != nil {
+				return fmt.Errorf("author %q: %w", d.Email, err)
+			}
+			for _, b := range d.Books {
+				b.AuthorID = sql.NullInt64{Int64: authorID, Valid: true}
+				if _, err := insertBook(tx, b); err != nil {
+					return fmt.Errorf("author %q: book %q: %w", d.Email, b.Title, err)
+				}
+			}
+		}
+		return nil
+	})
+}
+
+// upsertAuthorByEmail updates the name of the author with a's email, or
+// inserts a if there is none, and returns the author's id. A soft-deleted
+// author with that email is restored rather than duplicated, which the
+// unique email index would reject anyway.
+func upsertAuthorByEmail(tx *sqlx.Tx, a Author) (int64, error) {
+	if err := ValidateEmail(a.Email); err != nil {
+		return 0, err
+	}
+	var id int64
+	err := tx.Get(&id, "SELECT id FROM authors WHERE LOWER(email) = LOWER(?)", a.Email)
+	if err == nil {
+		_, err = tx.Exec("UPDATE authors SET name=?, deleted_at=NULL WHERE id=?", a.Name, id)
+		return id, err
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return 0, err
+	}
+	result, err := tx.NamedExec("INSERT INTO authors (name, email) VALUES (:name, :email)", a)
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
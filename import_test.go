@@ -0,0 +1,223 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestImportBooksConflictModes(t *testing.T) {
+	tests := []struct {
+		mode      ConflictMode
+		wantErr   bool
+		wantN     int64
+		wantTitle string
+		wantRows  int
+	}{
+		{ConflictSkip, false, 1, "Existing", 2},
+		{ConflictReplace, false, 2, "Imported", 2},
+		{ConflictError, true, 0, "Existing", 1},
+	}
+	for _, tt := range tests {
+		db := newTestDB(t)
+		db.MustExec("INSERT INTO books (id, title) VALUES (1, 'Existing')")
+		n, err := ImportBooks(db, []Book{{ID: 1, Title: "Imported"}, {Title: "New"}}, tt.mode)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("mode %d: err = %v, want error %v", tt.mode, err, tt.wantErr)
+		}
+		if n != tt.wantN {
+			t.Errorf("mode %d: imported %d, want %d", tt.mode, n, tt.wantN)
+		}
+		var title string
+		if err := db.Get(&title, "SELECT title FROM books WHERE id=1"); err != nil {
+			t.Fatal(err)
+		}
+		if title != tt.wantTitle {
+			t.Errorf("mode %d: book 1 is %q, want %q", tt.mode, title, tt.wantTitle)
+		}
+		if rows := count(t, db, "SELECT COUNT(*) FROM books"); rows != tt.wantRows {
+			t.Errorf("mode %d: %d books, want %d", tt.mode, rows, tt.wantRows)
+		}
+	}
+}
+
+func TestImportBooksCSVConflictModes(t *testing.T) {
+	const data = "id,title,author_id,published_year,genre\n1,Imported,2,1999,Horror\n,New,,,\n"
+	for _, mode := range []ConflictMode{ConflictSkip, ConflictReplace, ConflictError} {
+		db := newTestDB(t)
+		db.MustExec("INSERT INTO books (id, title) VALUES (1, 'Existing')")
+		n, err := ImportBooksCSV(context.Background(), db, strings.NewReader(data), mode)
+		var b Book
+		if err := db.Get(&b, "SELECT * FROM books WHERE id=1"); err != nil {
+			t.Fatal(err)
+		}
+		switch mode {
+		case ConflictSkip:
+			if err != nil || n != 1 || b.Title != "Existing" {
+				t.Errorf("skip: %d, %v, book 1 %q", n, err, b.Title)
+			}
+		case ConflictReplace:
+			if err != nil || n != 2 || b.Title != "Imported" || b.AuthorID != nullInt64(2) ||
+				b.PublishedYear != nullInt64(1999) || b.Genre != nullString("Horror") {
+				t.Errorf("replace: %d, %v, book 1 %+v", n, err, b)
+			}
+		case ConflictError:
+			if err == nil || n != 0 || b.Title != "Existing" || count(t, db, "SELECT COUNT(*) FROM books") != 1 {
+				t.Errorf("error: %d, %v, book 1 %q", n, err, b.Title)
+			}
+		}
+	}
+}
+
+func TestImportBooksUnknownMode(t *testing.T) {
+	db := newTestDB(t)
+	if _, err := ImportBooks(db, []Book{{Title: "x"}}, ConflictMode(42)); err == nil {
+		t.Error("want an error for an unknown mode")
+	}
+}
+
+// lineReader serves lines one per Read call, so the CSV reader only sees a
+// line once it asks for it, and calls onLine with the 1-based number of each
+// line served.
+type lineReader struct {
+	lines  []string
+	served int
+	onLine func(n int)
+}
+
+func (r *lineReader) Read(p []byte) (int, error) {
+	if r.served == len(r.lines) {
+		return 0, io.EOF
+	}
+	line := r.lines[r.served]
+	if len(p) < len(line) {
+		return 0, io.ErrShortBuffer
+	}
+	r.served++
+	r.onLine(r.served)
+	return copy(p, line), nil
+}
+
+func TestImportBooksCSVCancel(t *testing.T) {
+	db := newTestDB(t)
+	lines := []string{"title,author_id\n"}
+	for i := 0; i < 200; i++ {
+		lines = append(lines, fmt.Sprintf("Book %d,1\n", i))
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	r := &lineReader{lines: lines, onLine: func(n int) {
+		if n == 50 {
+			cancel()
+		}
+	}}
+
+	n, err := ImportBooksCSV(ctx, db, r, ConflictError)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("got %d, %v, want context.Canceled", n, err)
+	}
+	if r.served >= len(lines) {
+		t.Error("import read the whole input after cancellation")
+	}
+	if got := count(t, db, "SELECT COUNT(*) FROM books"); got != 0 {
+		t.Errorf("%d books left after cancel, want 0", got)
+	}
+}
+
+func TestImportAuthorsWithBooks(t *testing.T) {
+	db := newTestDB(t)
+	setClock(t, time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC))
+	db.MustExec("INSERT INTO authors (id, name, email) VALUES (1, 'Old Name', 'ann@example.com')")
+	data := []AuthorDetail{
+		{Author: Author{Name: "Ann", Email: "ANN@example.com"}, Books: []Book{{Title: "A1", AuthorID: nullInt64(42)}, {Title: "A2"}}},
+		{Author: Author{Name: "Bob", Email: "bob@example.com"}, Books: []Book{{Title: "B1", Genre: nullString("scifi")}}},
+	}
+	if err := ImportAuthorsWithBooks(db, data); err != nil {
+		t.Fatal(err)
+	}
+	if got := count(t, db, "SELECT COUNT(*) FROM authors WHERE id=1 AND name='Ann'"); got != 1 {
+		t.Error("existing author not updated in place")
+	}
+	if got := count(t, db, "SELECT COUNT(*) FROM books WHERE author_id=1"); got != 2 {
+		t.Errorf("existing author has %d books, want 2", got)
+	}
+	var bob Author
+	if err := db.Get(&bob, "SELECT * FROM authors WHERE email='bob@example.com'"); err != nil {
+		t.Fatal(err)
+	}
+	if got := count(t, db, "SELECT COUNT(*) FROM books WHERE author_id=? AND genre='Sci-Fi'", bob.ID); got != 1 {
+		t.Error("new author's book not inserted like InsertBook")
+	}
+}
+
+func TestImportAuthorsWithBooksRestoresDeleted(t *testing.T) {
+	db := newTestDB(t)
+	setClock(t, time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC))
+	db.MustExec("INSERT INTO authors (id, name, email) VALUES (1, 'Ann', 'ann@example.com')")
+	if err := SoftDeleteAuthor(db, 1); err != nil {
+		t.Fatal(err)
+	}
+	data := []AuthorDetail{{Author: Author{Name: "Ann B", Email: "ann@example.com"}, Books: []Book{{Title: "A1"}}}}
+	if err := ImportAuthorsWithBooks(db, data); err != nil {
+		t.Fatal(err)
+	}
+	if got := count(t, db, "SELECT COUNT(*) FROM authors WHERE id=1 AND name='Ann B' AND deleted_at IS NULL"); got != 1 {
+		t.Error("soft-deleted author not restored")
+	}
+	if got := count(t, db, "SELECT COUNT(*) FROM authors"); got != 1 {
+		t.Errorf("%d authors, want 1", got)
+	}
+}
+
+func TestImportAuthorsWithBooksRollsBack(t *testing.T) {
+	db := newTestDB(t)
+	setClock(t, time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC))
+	for _, data := range [][]AuthorDetail{
+		{{Author: Author{Name: "Ann", Email: "ann@example.com"}, Books: []Book{{Title: "A1"}}},
+			{Author: Author{Name: "Bad", Email: "not an email"}}},
+		{{Author: Author{Name: "Ann", Email: "ann@example.com"}, Books: []Book{{Title: "A1"}, {Title: "Future", PublishedYear: nullInt64(2030)}}}},
+	} {
+		if err := ImportAuthorsWithBooks(db, data); err == nil {
+			t.Error("invalid import accepted")
+		}
+	}
+	if count(t, db, "SELECT COUNT(*) FROM authors")+count(t, db, "SELECT COUNT(*) FROM books") != 0 {
+		t.Error("failed imports left rows behind")
+	}
+}
+
+func TestImportBooksValidates(t *testing.T) {
+	db := newTestDB(t)
+	setClock(t, time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC))
+	n, err := ImportBooks(db, []Book{{Title: "Ok", PublishedYear: nullInt64(1999), Genre: nullString("scifi")},
+		{Title: "Future", PublishedYear: nullInt64(3000)}}, ConflictSkip)
+	if !errors.Is(err, ErrFutureYear) || n != 0 {
+		t.Errorf("future year: %d, %v, want ErrFutureYear", n, err)
+	}
+	if got := count(t, db, "SELECT COUNT(*) FROM books"); got != 0 {
+		t.Errorf("%d books left after a rejected import, want 0", got)
+	}
+
+	if _, err := ImportBooks(db, []Book{{Title: "Ok", Genre: nullString(" sci fi ")}}, ConflictSkip); err != nil {
+		t.Fatal(err)
+	}
+	if got := count(t, db, "SELECT COUNT(*) FROM books WHERE genre='Sci-Fi' AND copies=1"); got != 1 {
+		t.Error("imported book not normalized like InsertBook")
+	}
+}
+
+func TestImportBooksCSVFutureYear(t *testing.T) {
+	db := newTestDB(t)
+	setClock(t, time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC))
+	const data = "title,author_id,published_year,genre\nOk,1,1999,scifi\nFuture,1,3000,\n"
+	if _, err := ImportBooksCSV(context.Background(), db, strings.NewReader(data), ConflictSkip); !errors.Is(err, ErrFutureYear) {
+		t.Errorf("future year: %v, want ErrFutureYear", err)
+	}
+	if got := count(t, db, "SELECT COUNT(*) FROM books"); got != 0 {
+		t.Errorf("%d books left after a rejected import, want 0", got)
+	}
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// BookAndAuthorColumns is the select list for a books/authors join that
+// ScanBookAndAuthor understands: every book column is aliased "book.<col>"
+// and every author column "author.<col>". Use it as
+//
+//	SELECT ` + BookAndAuthorColumns + ` FROM books JOIN authors ON authors.id = books.author_id
+var BookAndAuthorColumns = prefixedColumns("books", "book", Book{}) + ", " + prefixedColumns("authors", "author", Author{})
+
+// prefixedColumns lists the columns of model read from table, each aliased
+// as "<prefix>.<column>".
+func prefixedColumns(table, prefix string, model interface{}) string {
+	fields := dbFields(model)
+	columns := make([]string, len(fields))
+	for i, f := range fields {
+		columns[i] = table + "." + f.Column + ` AS "` + prefix + "." + f.Column + `"`
+	}
+	return strings.Join(columns, ", ")
+}
+
+// ScanBookAndAuthor scans the current row of a query selecting
+// BookAndAuthorColumns into a separate Book and Author.
+func ScanBookAndAuthor(rows *sqlx.Rows) (Book, Author, error) {
+	var row struct {
+		Book   Book   `db:"book"`
+		Author Author `db:"author"`
+	}
+	if err := rows.StructScan(&row); err != nil {
+		return Book{}, Author{}, err
+	}
+	return row.Book, row.Author, nil
+}
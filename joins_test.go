@@ -0,0 +1,28 @@
+package main
+
+import "testing"
+
+func TestScanBookAndAuthor(t *testing.T) {
+	db := newTestDB(t)
+	db.MustExec("INSERT INTO authors (id, name, email) VALUES (7, 'Ann', 'ann@example.com')")
+	db.MustExec("INSERT INTO books (id, title, author_id) VALUES (3, 'Dune', 7)")
+	rows, err := db.Queryx("SELECT " + BookAndAuthorColumns + " FROM books JOIN authors ON authors.id = books.author_id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	if !rows.Next() {
+		t.Fatal("no rows")
+	}
+	book, author, err := ScanBookAndAuthor(rows)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Both tables have id columns; each must land in its own struct.
+	if book.ID != 3 || book.Title != "Dune" || book.AuthorID != nullInt64(7) {
+		t.Errorf("book = %+v", book)
+	}
+	if author.ID != 7 || author.Name != "Ann" {
+		t.Errorf("author = %+v", author)
+	}
+}
@@ -0,0 +1,283 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+var (
+	// ErrBookUnavailable is returned when every copy of a book is on loan.
+	ErrBookUnavailable = errors.New("book is not available")
+	// ErrLoanReturned is returned when changing a loan that has been closed.
+	ErrLoanReturned = errors.New("loan already returned")
+	// ErrMaxRenewals is returned when a loan has used up its renewals.
+	ErrMaxRenewals = errors.New("loan renewal limit reached")
+)
+
+// availableCopiesQuery computes a book's copies minus its active loans,
+// clamped at 0. It yields no row if the book does not exist.
+const availableCopiesQuery = `SELECT MAX(copies - (SELECT COUNT(*) FROM loans
+		WHERE loans.book_id = books.id AND loans.return_date IS NULL), 0)
+	FROM books WHERE id=?`
+
+// BookAvailableCopies returns how many copies of a book are not on loan. It
+// returns sql.ErrNoRows if the book does not exist.
+func BookAvailableCopies(db *sqlx.DB, bookID int) (int, error) {
+	var available int
+	err := db.Get(&available, availableCopiesQuery, bookID)
+	return available, err
+}
+
+// checkoutBook creates a loan for bookID within tx after checking that the
+// book exists and has a copy that is not on loan, and returns the new loan
+// id.
+func checkoutBook(tx *sqlx.Tx, bookID, memberID int, checkout, due time.Time) (int64, error) {
+	var available int
+	if err := tx.Get(&available, availableCopiesQuery, bookID); err != nil {
+		return 0, fmt.Errorf("book %d: %w", bookID, err)
+	}
+	if available == 0 {
+		return 0, fmt.Errorf("book %d: %w", bookID, ErrBookUnavailable)
+	}
+	result, err := tx.Exec("INSERT INTO loans (book_id, member_id, checkout_date, due_date) VALUES (?, ?, ?, ?)",
+		bookID, memberID, checkout.UTC(), due.UTC())
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+// CheckoutBooks lends several books to a member at once and returns the new
+// loan ids in the order of bookIDs. If any book is missing or has no copy
+// left, no loans are created and the error wraps ErrBookUnavailable or
+// sql.ErrNoRows.
+func CheckoutBooks(db *sqlx.DB, memberID int, bookIDs []int, due time.Time) ([]int64, error) {
+	now := time.Now()
+	return InTxValue(db, func(tx *sqlx.Tx) ([]int64, error) {
+		loanIDs := make([]int64, 0, len(bookIDs))
+		for _, bookID := range bookIDs {
+			id, err := checkoutBook(tx, bookID, memberID, now, due)
+			if err != nil {
+				return nil, err
+			}
+			loanIDs = append(loanIDs, id)
+		}
+		return loanIDs, nil
+	})
+}
+
+// LoanPolicy sets the terms of new loans.
+type LoanPolicy struct {
+	// Days is the loan period; a loan checked out at now is due Days
+	// calendar days later.
+	Days int
+}
+
+// DueDate returns when a loan checked out at now is due under p.
+func (p LoanPolicy) DueDate(now time.Time) time.Time {
+	return now.AddDate(0, 0, p.Days)
+}
+
+// CheckoutWithPolicy lends a book to a member at now with the due date set by
+// policy and returns the new loan id. As with CheckoutBooks, the error wraps
+// ErrBookUnavailable or sql.ErrNoRows if the book cannot be lent.
+func CheckoutWithPolicy(db *sqlx.DB, bookID, memberID int, policy LoanPolicy, now time.Time) (int64, error) {
+	if policy.Days <= 0 {
+		return 0, errors.New("loan policy days must be positive")
+	}
+	return InTxValue(db, func(tx *sqlx.Tx) (int64, error) {
+		return checkoutBook(tx, bookID, memberID, now, policy.DueDate(now))
+	})
+}
+
+// ReturnBooks marks the given loans as returned at returnedAt in a single
+// transaction. Loans that were already returned are left untouched, so the
+// returned count only includes loans that were still active.
+func ReturnBooks(db *sqlx.DB, loanIDs []int, returnedAt time.Time) (returned int64, err error) {
+	if len(loanIDs) == 0 {
+		return 0, nil
+	}
+	query, args, err := sqlx.In(`UPDATE loans SET return_date=? WHERE id IN (?) AND return_date IS NULL`,
+		returnedAt.UTC(), loanIDs)
+	if err != nil {
+		return 0, err
+	}
+	err = InTx(db, func(tx *sqlx.Tx) error {
+		result, err := tx.Exec(tx.Rebind(query), args...)
+		if err != nil {
+			return err
+		}
+		returned, err = result.RowsAffected()
+		return err
+	})
+	return returned, err
+}
+
+// ActiveLoanForBook returns the open loan for a book, if it is currently out.
+// For a book with several copies out it returns the oldest open loan. The
+// lookup is served by the partial index idx_loans_active_book.
+func ActiveLoanForBook(db *sqlx.DB, bookID int) (Loan, bool, error) {
+	var loan Loan
+	err := db.Get(&loan, "SELECT * FROM loans WHERE book_id=? AND return_date IS NULL ORDER BY id LIMIT 1", bookID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Loan{}, false, nil
+	}
+	if err != nil {
+		return Loan{}, false, err
+	}
+	return loan, true, nil
+}
+
+// LoanWithMember is a loan together with the borrowing member's contact
+// details.
+type LoanWithMember struct {
+	Loan
+	MemberName  string `db:"member_name"`
+	MemberEmail string `db:"member_email"`
+}
+
+// LoansDueSoon returns active loans due between now and now+within,
+// inclusive, ordered by due date, with the member's name and email for
+// sending reminders.
+func LoansDueSoon(db *sqlx.DB, within time.Duration, now time.Time) ([]LoanWithMember, error) {
+	loans := []LoanWithMember{}
+	err := db.Select(&loans, `SELECT loans.*, members.name AS member_name, members.email AS member_email
+		FROM loans JOIN members ON members.id = loans.member_id
+		WHERE loans.return_date IS NULL AND loans.due_date BETWEEN ? AND ?
+		ORDER BY loans.due_date, loans.id`, now.UTC(), now.Add(within).UTC())
+	return loans, err
+}
+
+// RenewLoan pushes an active loan's due date back by extend and counts the
+// renewal. It returns ErrLoanReturned for a returned loan, ErrMaxRenewals if
+// the loan has already been renewed maxRenewals times, and sql.ErrNoRows if
+// the loan does not exist.
+func RenewLoan(db *sqlx.DB, loanID int, extend time.Duration, maxRenewals int) error {
+	return InTx(db, func(tx *sqlx.Tx) error {
+		var loan Loan
+		if err := tx.Get(&loan, "SELECT * FROM loans WHERE id=?", loanID); err != nil {
+			return err
+		}
+		if loan.ReturnDate.Valid {
+			return ErrLoanReturned
+		}
+		if loan.Renewals >= maxRenewals {
+			return ErrMaxRenewals
+		}
+		_, err := tx.Exec("UPDATE loans SET due_date=?, renewals=renewals+1 WHERE id=?",
+			loan.DueDate.Add(extend).UTC(), loanID)
+		return err
+	})
+}
+
+// ArchiveReturnedLoans moves loans returned before the given time from loans
+// into loans_archive, keeping their ids, and returns how many were moved.
+// Active loans are never archived.
+func ArchiveReturnedLoans(db *sqlx.DB, before time.Time) (int64, error) {
+	return InTxValue(db, func(tx *sqlx.Tx) (int64, error) {
+		const where = "return_date IS NOT NULL AND return_date < ?"
+		result, err := tx.Exec(`INSERT INTO loans_archive (id, book_id, member_id, checkout_date, due_date, return_date, renewals)
+			SELECT id, book_id, member_id, checkout_date, due_date, return_date, renewals FROM loans WHERE `+where, before.UTC())
+		if err != nil {
+			return 0, err
+		}
+		archived, err := result.RowsAffected()
+		if err != nil {
+			return 0, err
+		}
+		if _, err := tx.Exec("DELETE FROM loans WHERE "+where, before.UTC()); err != nil {
+			return 0, err
+		}
+		return archived, nil
+	})
+}
+
+// LoansInPeriod returns loans checked out between from and to, both
+// inclusive, ordered by checkout date.
+func LoansInPeriod(db *sqlx.DB, from, to time.Time) ([]Loan, error) {
+	loans := []Loan{}
+	err := db.Select(&loans, `SELECT * FROM loans
+		WHERE checkout_date BETWEEN ? AND ?
+		ORDER BY checkout_date, id`, from.UTC(), to.UTC())
+	return loans, err
+}
+
+// LoanStatus describes whether a book can be borrowed right now. When every
+// copy is out, DueDate and BorrowerName describe the loan due back first.
+type LoanStatus struct {
+	Available    bool
+	DueDate      *time.Time
+	BorrowerName string
+}
+
+// BookLoanStatus returns the loan status of a book. It returns sql.ErrNoRows
+// if the book does not exist.
+func BookLoanStatus(db *sqlx.DB, bookID int) (LoanStatus, error) {
+	available, err := BookAvailableCopies(db, bookID)
+	if err != nil {
+		return LoanStatus{}, err
+	}
+	if available > 0 {
+		return LoanStatus{Available: true}, nil
+	}
+	var loan struct {
+		DueDate      time.Time `db:"due_date"`
+		BorrowerName string    `db:"borrower_name"`
+	}
+	err = db.Get(&loan, `SELECT loans.due_date, COALESCE(members.name, '') AS borrower_name
+		FROM loans LEFT JOIN members ON members.id = loans.member_id
+		WHERE loans.book_id=? AND loans.return_date IS NULL
+		ORDER BY loans.due_date, loans.id LIMIT 1`, bookID)
+	if errors.Is(err, sql.ErrNoRows) {
+		// No copies and no loans: nothing will come back.
+		return LoanStatus{}, nil
+	}
+	if err != nil {
+		return LoanStatus{}, err
+	}
+	return LoanStatus{DueDate: &loan.DueDate, BorrowerName: loan.BorrowerName}, nil
+}
+
+// MemberLoansAfter returns up to limit of a member's loans, active or
+// returned, with ids greater than afterLoanID, ordered by id. Pass 0 for the
+// first page and the id of the last loan received for each following page;
+// a short or empty page means there are no more loans.
+func MemberLoansAfter(db *sqlx.DB, memberID, afterLoanID, limit int) ([]Loan, error) {
+	loans := []Loan{}
+	err := db.Select(&loans, "SELECT * FROM loans WHERE member_id=? AND id > ? ORDER BY id LIMIT ?", memberID, afterLoanID, limit)
+	return loans, err
+}
+
+// MemberTotalBorrowed returns how many loans a member has ever had, counting
+// active, returned and archived loans.
+func MemberTotalBorrowed(db *sqlx.DB, memberID int) (int, error) {
+	var total int
+	err := db.Get(&total, `SELECT (SELECT COUNT(*) FROM loans WHERE member_id=?)
+		+ (SELECT COUNT(*) FROM loans_archive WHERE member_id=?)`, memberID, memberID)
+	return total, err
+}
+
+// MemberBorrowCount is a member with the number of loans they have had.
+type MemberBorrowCount struct {
+	MemberID int    `db:"member_id"`
+	Name     string `db:"name"`
+	Loans    int    `db:"loans"`
+}
+
+// TopBorrowers returns up to limit members ranked by how many loans they have
+// ever had, counted as in MemberTotalBorrowed, with ties going to the lowest
+// member id. Members without loans are left out.
+func TopBorrowers(db *sqlx.DB, limit int) ([]MemberBorrowCount, error) {
+	top := []MemberBorrowCount{}
+	err := db.Select(&top, `SELECT members.id AS member_id, members.name, COUNT(*) AS loans
+		FROM (SELECT member_id FROM loans UNION ALL SELECT member_id FROM loans_archive) AS l
+		JOIN members ON members.id = l.member_id
+		GROUP BY members.id
+		ORDER BY loans DESC, members.id
+		LIMIT ?`, limit)
+	return top, err
+}
@@ -0,0 +1,412 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReturnBooks(t *testing.T) {
+	db := newTestDB(t)
+	checkout := time.Date(2024, 1, 10, 12, 0, 0, 0, time.UTC)
+	due := checkout.AddDate(0, 0, 14)
+	earlier := checkout.AddDate(0, 0, 3)
+	active1 := seedLoan(t, db, 1, 1, checkout, due, nil)
+	returned := seedLoan(t, db, 2, 1, checkout, due, &earlier)
+	active2 := seedLoan(t, db, 3, 2, checkout, due, nil)
+	untouched := seedLoan(t, db, 4, 2, checkout, due, nil)
+
+	at := checkout.AddDate(0, 0, 7)
+	n, err := ReturnBooks(db, []int{active1, returned, active2, 999}, at)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Errorf("returned %d loans, want 2", n)
+	}
+
+	var loans []Loan
+	if err := db.Select(&loans, "SELECT * FROM loans ORDER BY id"); err != nil {
+		t.Fatal(err)
+	}
+	want := map[int]time.Time{active1: at, returned: earlier, active2: at}
+	for _, l := range loans {
+		if l.ID == untouched {
+			if l.ReturnDate.Valid {
+				t.Errorf("loan %d not in the batch was returned", l.ID)
+			}
+			continue
+		}
+		if !l.ReturnDate.Valid || !l.ReturnDate.Time.Equal(want[l.ID]) {
+			t.Errorf("loan %d return date = %v, want %v", l.ID, l.ReturnDate, want[l.ID])
+		}
+	}
+}
+
+func TestReturnBooksEmpty(t *testing.T) {
+	db := newTestDB(t)
+	n, err := ReturnBooks(db, nil, time.Now())
+	if err != nil || n != 0 {
+		t.Errorf("ReturnBooks(nil) = %d, %v", n, err)
+	}
+}
+
+func TestActiveLoanForBook(t *testing.T) {
+	db := newTestDB(t)
+	checkout := time.Date(2024, 2, 1, 9, 0, 0, 0, time.UTC)
+	due := checkout.AddDate(0, 0, 14)
+	returned := checkout.AddDate(0, 0, 2)
+	active := seedLoan(t, db, 1, 7, checkout, due, nil)
+	seedLoan(t, db, 2, 7, checkout, due, &returned)
+
+	loan, out, err := ActiveLoanForBook(db, 1)
+	if err != nil || !out || loan.ID != active || loan.MemberID != 7 || !loan.DueDate.Equal(due) {
+		t.Errorf("book on loan: %+v, %v, %v", loan, out, err)
+	}
+	for _, bookID := range []int{2, 3} {
+		loan, out, err := ActiveLoanForBook(db, bookID)
+		if err != nil || out || loan != (Loan{}) {
+			t.Errorf("book %d: %+v, %v, %v, want not out", bookID, loan, out, err)
+		}
+	}
+}
+
+func TestActiveLoanUsesPartialIndex(t *testing.T) {
+	db := newTestDB(t)
+	plan, err := Explain(db, "SELECT * FROM loans WHERE book_id=? AND return_date IS NULL ORDER BY id LIMIT 1", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(plan, "idx_loans_active_book") {
+		t.Errorf("plan does not use the partial index:\n%s", plan)
+	}
+}
+
+func TestCheckoutBooks(t *testing.T) {
+	db := newTestDB(t)
+	db.MustExec("INSERT INTO books (id, title) VALUES (1, 'One'), (2, 'Two'), (3, 'Three')")
+	due := time.Now().AddDate(0, 0, 14)
+
+	ids, err := CheckoutBooks(db, 7, []int{1, 2}, due)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != 2 {
+		t.Fatalf("got %d loan ids, want 2", len(ids))
+	}
+	for i, id := range ids {
+		var bookID int
+		if err := db.Get(&bookID, "SELECT book_id FROM loans WHERE id=? AND member_id=7", id); err != nil {
+			t.Fatal(err)
+		}
+		if bookID != i+1 {
+			t.Errorf("loan %d is for book %d, want %d", id, bookID, i+1)
+		}
+	}
+}
+
+func TestCheckoutBooksRollsBack(t *testing.T) {
+	db := newTestDB(t)
+	db.MustExec("INSERT INTO books (id, title) VALUES (1, 'One'), (2, 'Two'), (3, 'Three')")
+	now := time.Now()
+	seedLoan(t, db, 2, 8, now, now.AddDate(0, 0, 14), nil)
+
+	_, err := CheckoutBooks(db, 7, []int{1, 2, 3}, now.AddDate(0, 0, 14))
+	if !errors.Is(err, ErrBookUnavailable) {
+		t.Fatalf("got %v, want ErrBookUnavailable", err)
+	}
+	if n := count(t, db, "SELECT COUNT(*) FROM loans WHERE member_id=7"); n != 0 {
+		t.Errorf("%d loans created despite the failure", n)
+	}
+	if _, err := CheckoutBooks(db, 7, []int{1, 99}, now); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("missing book: %v, want sql.ErrNoRows", err)
+	}
+}
+
+func TestLoansDueSoon(t *testing.T) {
+	db := newTestDB(t)
+	db.MustExec("INSERT INTO members (id, name, email) VALUES (1, 'Ann', 'ann@example.com'), (2, 'Bob', 'bob@example.com')")
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	out := now.AddDate(0, 0, -10)
+	returned := now.Add(-time.Hour)
+	later := seedLoan(t, db, 1, 1, out, now.Add(48*time.Hour), nil)
+	soon := seedLoan(t, db, 2, 2, out, now.Add(time.Hour), nil)
+	seedLoan(t, db, 3, 1, out, now.Add(4*24*time.Hour), nil)       // outside the window
+	seedLoan(t, db, 4, 1, out, now.Add(-time.Hour), nil)           // already overdue
+	seedLoan(t, db, 5, 1, out, now.Add(time.Hour), &returned)      // returned
+	edge := seedLoan(t, db, 6, 2, out, now.Add(72*time.Hour), nil) // exactly at the end
+
+	loans, err := LoansDueSoon(db, 72*time.Hour, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []int
+	for _, l := range loans {
+		got = append(got, l.ID)
+	}
+	if want := []int{soon, later, edge}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("loans = %v, want %v", got, want)
+	}
+	if loans[0].MemberName != "Bob" || loans[0].MemberEmail != "bob@example.com" {
+		t.Errorf("first loan member = %q <%s>", loans[0].MemberName, loans[0].MemberEmail)
+	}
+}
+
+func TestRenewLoan(t *testing.T) {
+	db := newTestDB(t)
+	checkout := time.Date(2024, 4, 1, 10, 0, 0, 0, time.UTC)
+	due := checkout.AddDate(0, 0, 14)
+	id := seedLoan(t, db, 1, 1, checkout, due, nil)
+	week := 7 * 24 * time.Hour
+
+	for i := 1; i <= 2; i++ {
+		if err := RenewLoan(db, id, week, 2); err != nil {
+			t.Fatalf("renewal %d: %v", i, err)
+		}
+	}
+	if err := RenewLoan(db, id, week, 2); !errors.Is(err, ErrMaxRenewals) {
+		t.Errorf("third renewal: %v, want ErrMaxRenewals", err)
+	}
+	var loan Loan
+	if err := db.Get(&loan, "SELECT * FROM loans WHERE id=?", id); err != nil {
+		t.Fatal(err)
+	}
+	if want := due.Add(2 * week); !loan.DueDate.Equal(want) || loan.Renewals != 2 {
+		t.Errorf("loan due %s with %d renewals, want %s with 2", loan.DueDate, loan.Renewals, want)
+	}
+
+	returned := seedLoan(t, db, 2, 1, checkout, due, &due)
+	if err := RenewLoan(db, returned, week, 2); !errors.Is(err, ErrLoanReturned) {
+		t.Errorf("returned loan: %v, want ErrLoanReturned", err)
+	}
+	if err := RenewLoan(db, 999, week, 2); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("missing loan: %v, want sql.ErrNoRows", err)
+	}
+}
+
+func TestArchiveReturnedLoans(t *testing.T) {
+	db := newTestDB(t)
+	checkout := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	due := checkout.AddDate(0, 0, 14)
+	early := checkout.AddDate(0, 0, 5)
+	late := checkout.AddDate(0, 2, 0)
+	old := seedLoan(t, db, 1, 1, checkout, due, &early)
+	recent := seedLoan(t, db, 2, 1, checkout, due, &late)
+	active := seedLoan(t, db, 3, 1, checkout, due, nil)
+
+	n, err := ArchiveReturnedLoans(db, checkout.AddDate(0, 1, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Errorf("archived %d loans, want 1", n)
+	}
+	if got := count(t, db, "SELECT COUNT(*) FROM loans_archive WHERE id=? AND book_id=1", old); got != 1 {
+		t.Error("old loan not archived under its id")
+	}
+	var left []int
+	if err := db.Select(&left, "SELECT id FROM loans ORDER BY id"); err != nil {
+		t.Fatal(err)
+	}
+	if want := []int{recent, active}; !reflect.DeepEqual(left, want) {
+		t.Errorf("loans left = %v, want %v", left, want)
+	}
+	if total, err := MemberTotalBorrowed(db, 1); err != nil || total != 3 {
+		t.Errorf("total borrowed = %d, %v, want 3", total, err)
+	}
+}
+
+func TestLoansInPeriod(t *testing.T) {
+	db := newTestDB(t)
+	from := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2024, 3, 31, 23, 59, 59, 0, time.UTC)
+	due := to.AddDate(0, 1, 0)
+	seedLoan(t, db, 1, 1, from.Add(-time.Second), due, nil)
+	atStart := seedLoan(t, db, 2, 1, from, due, nil)
+	mid := seedLoan(t, db, 3, 1, from.AddDate(0, 0, 10), due, nil)
+	atEnd := seedLoan(t, db, 4, 1, to, due, nil)
+	seedLoan(t, db, 5, 1, to.Add(time.Second), due, nil)
+
+	// Bounds in another zone denote the same instants.
+	est := time.FixedZone("EST", -5*3600)
+	loans, err := LoansInPeriod(db, from.In(est), to.In(est))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []int
+	for _, l := range loans {
+		got = append(got, l.ID)
+	}
+	if want := []int{atStart, mid, atEnd}; !reflect.DeepEqual(got, want) {
+		t.Errorf("loans = %v, want %v", got, want)
+	}
+}
+
+func TestBookAvailableCopies(t *testing.T) {
+	db := newTestDB(t)
+	db.MustExec("INSERT INTO books (id, title, copies) VALUES (1, 'Popular', 3)")
+	now := time.Now()
+	due := now.AddDate(0, 0, 14)
+	want := []int{3, 2, 1, 0}
+	for i, w := range want {
+		if got, err := BookAvailableCopies(db, 1); err != nil || got != w {
+			t.Fatalf("after %d loans: %d available, %v, want %d", i, got, err, w)
+		}
+		if i < len(want)-1 {
+			if _, err := CheckoutBooks(db, 1, []int{1}, due); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if _, err := CheckoutBooks(db, 1, []int{1}, due); !errors.Is(err, ErrBookUnavailable) {
+		t.Errorf("fourth checkout: %v, want ErrBookUnavailable", err)
+	}
+	// Shrinking the stock below the loans out clamps at zero.
+	db.MustExec("UPDATE books SET copies=1 WHERE id=1")
+	if got, err := BookAvailableCopies(db, 1); err != nil || got != 0 {
+		t.Errorf("over-lent book: %d available, %v, want 0", got, err)
+	}
+	if _, err := BookAvailableCopies(db, 99); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("missing book: %v, want sql.ErrNoRows", err)
+	}
+}
+
+func TestCheckoutWithPolicy(t *testing.T) {
+	db := newTestDB(t)
+	db.MustExec("INSERT INTO books (id, title) VALUES (1, 'A')")
+	now := time.Date(2024, 1, 31, 15, 0, 0, 0, time.UTC)
+	id, err := CheckoutWithPolicy(db, 1, 5, LoanPolicy{Days: 30}, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var loan Loan
+	if err := db.Get(&loan, "SELECT * FROM loans WHERE id=?", id); err != nil {
+		t.Fatal(err)
+	}
+	if want := time.Date(2024, 3, 1, 15, 0, 0, 0, time.UTC); !loan.DueDate.Equal(want) || !loan.CheckoutDate.Equal(now) {
+		t.Errorf("loan out %s due %s, want out %s due %s", loan.CheckoutDate, loan.DueDate, now, want)
+	}
+	if _, err := CheckoutWithPolicy(db, 1, 6, LoanPolicy{Days: 30}, now); !errors.Is(err, ErrBookUnavailable) {
+		t.Errorf("second checkout: %v, want ErrBookUnavailable", err)
+	}
+	if _, err := CheckoutWithPolicy(db, 1, 6, LoanPolicy{}, now); err == nil {
+		t.Error("zero-day policy accepted")
+	}
+}
+
+func TestBookLoanStatus(t *testing.T) {
+	db := newTestDB(t)
+	db.MustExec("INSERT INTO members (id, name, email) VALUES (1, 'Ann', 'ann@example.com'), (2, 'Bob', 'bob@example.com')")
+	db.MustExec("INSERT INTO books (id, title, copies) VALUES (1, 'Free', 1), (2, 'Out', 2), (3, 'None', 0)")
+	now := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	seedLoan(t, db, 2, 1, now, now.AddDate(0, 0, 20), nil)
+	seedLoan(t, db, 2, 2, now, now.AddDate(0, 0, 10), nil)
+
+	if s, err := BookLoanStatus(db, 1); err != nil || s != (LoanStatus{Available: true}) {
+		t.Errorf("free book: %+v, %v", s, err)
+	}
+	s, err := BookLoanStatus(db, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Available || s.DueDate == nil || !s.DueDate.Equal(now.AddDate(0, 0, 10)) || s.BorrowerName != "Bob" {
+		t.Errorf("lent-out book: %+v, want Bob's loan due first", s)
+	}
+	if s, err := BookLoanStatus(db, 3); err != nil || s != (LoanStatus{}) {
+		t.Errorf("book without copies: %+v, %v", s, err)
+	}
+	if _, err := BookLoanStatus(db, 99); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("missing book: %v, want sql.ErrNoRows", err)
+	}
+}
+
+func TestMemberLoansAfter(t *testing.T) {
+	db := newTestDB(t)
+	now := time.Now()
+	var want []int
+	for i := 0; i < 7; i++ {
+		want = append(want, seedLoan(t, db, i+1, 1, now, now, nil))
+		seedLoan(t, db, i+1, 2, now, now, nil) // another member, interleaved
+	}
+	var got []int
+	after := 0
+	for pages := 0; ; pages++ {
+		if pages > 4 {
+			t.Fatal("pagination did not end")
+		}
+		page, err := MemberLoansAfter(db, 1, after, 3)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, l := range page {
+			if l.MemberID != 1 {
+				t.Errorf("loan %d belongs to member %d", l.ID, l.MemberID)
+			}
+			got = append(got, l.ID)
+		}
+		if len(page) < 3 {
+			break
+		}
+		after = page[len(page)-1].ID
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("paged loans = %v, want %v", got, want)
+	}
+}
+
+func TestMemberTotalBorrowed(t *testing.T) {
+	db := newTestDB(t)
+	if total, err := MemberTotalBorrowed(db, 1); err != nil || total != 0 {
+		t.Errorf("no loans: %d, %v, want 0", total, err)
+	}
+	checkout := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	returned := checkout.AddDate(0, 0, 3)
+	seedLoan(t, db, 1, 1, checkout, returned, &returned)
+	seedLoan(t, db, 2, 1, checkout, returned, &returned)
+	if _, err := ArchiveReturnedLoans(db, returned.Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	later := returned.AddDate(0, 1, 0)
+	seedLoan(t, db, 3, 1, later, later, &later)
+	seedLoan(t, db, 4, 1, later, later, nil)
+	seedLoan(t, db, 4, 2, later, later, nil)
+
+	if total, err := MemberTotalBorrowed(db, 1); err != nil || total != 4 {
+		t.Errorf("total = %d, %v, want 4 (2 archived, 1 returned, 1 active)", total, err)
+	}
+}
+
+func TestTopBorrowers(t *testing.T) {
+	db := newTestDB(t)
+	db.MustExec(`INSERT INTO members (id, name, email) VALUES (1, 'Ann', 'ann@example.com'),
+		(2, 'Bob', 'bob@example.com'), (3, 'Cy', 'cy@example.com'), (4, 'Idle', 'idle@example.com')`)
+	checkout := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	returned := checkout.AddDate(0, 0, 3)
+	// Bob's three loans are all archived; Ann and Cy tie on two.
+	for i := 0; i < 3; i++ {
+		seedLoan(t, db, 1, 2, checkout, returned, &returned)
+	}
+	if _, err := ArchiveReturnedLoans(db, returned.Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	later := returned.AddDate(0, 1, 0)
+	seedLoan(t, db, 1, 3, later, later, nil)
+	seedLoan(t, db, 2, 3, later, later, &later)
+	seedLoan(t, db, 3, 1, later, later, nil)
+	seedLoan(t, db, 4, 1, later, later, nil)
+
+	top, err := TopBorrowers(db, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []MemberBorrowCount{{2, "Bob", 3}, {1, "Ann", 2}, {3, "Cy", 2}}
+	if !reflect.DeepEqual(top, want) {
+		t.Errorf("top borrowers = %+v, want %+v", top, want)
+	}
+	if top, _ = TopBorrowers(db, 1); len(top) != 1 || top[0].MemberID != 2 {
+		t.Errorf("limit 1: %+v, want only Bob", top)
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"sync"
+	"time"
+)
+
+// Logger receives the query and error logs of the generic helpers such as
+// GetOrZero, GetMap and Count, and TimedSelect's slow-query warnings. kv
+// holds alternating keys and values, as in log/slog, so a *slog.Logger
+// satisfies it directly.
+type Logger interface {
+	Debug(msg string, kv ...any)
+	Error(msg string, kv ...any)
+}
+
+// nopLogger discards everything; it is the default Logger.
+type nopLogger struct{}
+
+func (nopLogger) Debug(string, ...any) {}
+func (nopLogger) Error(string, ...any) {}
+
+var (
+	loggerMu sync.RWMutex
+	logger   Logger = nopLogger{}
+)
+
+// SetLogger replaces the package logger. Passing nil restores the default
+// no-op logger. It is safe to call while queries are running.
+func SetLogger(l Logger) {
+	if l == nil {
+		l = nopLogger{}
+	}
+	loggerMu.Lock()
+	logger = l
+	loggerMu.Unlock()
+}
+
+// currentLogger returns the logger set by SetLogger.
+func currentLogger() Logger {
+	loggerMu.RLock()
+	defer loggerMu.RUnlock()
+	return logger
+}
+
+// logQuery logs query at debug level and, if err is a real failure (not
+// sql.ErrNoRows), logs it at error level together with the query text.
+func logQuery(query string, err error) {
+	l := currentLogger()
+	l.Debug("query", "sql", query)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		l.Error("query failed", "sql", query, "err", err)
+	}
+}
+
+// logSlowQuery reports a query that ran longer than threshold. Logger has
+// no warning level, so the report goes out at error level. Until SetLogger
+// is called it is written with the standard log package instead, so slow
+// queries are not silently dropped by the default no-op logger.
+func logSlowQuery(query string, elapsed, threshold time.Duration) {
+	l := currentLogger()
+	if _, ok := l.(nopLogger); ok {
+		log.Printf("slow query (%s > %s): %s", elapsed, threshold, query)
+		return
+	}
+	l.Error("slow query", "sql", query, "elapsed", elapsed, "threshold", threshold)
+}
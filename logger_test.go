@@ -0,0 +1,98 @@
+package main
+
+import (
+	"sync"
+	"testing"
+)
+
+// logEntry is one call recorded by recordingLogger.
+type logEntry struct {
+	level, msg string
+	kv         []any
+}
+
+// get returns the value logged under key, or nil.
+func (e logEntry) get(key string) any {
+	for i := 0; i+1 < len(e.kv); i += 2 {
+		if e.kv[i] == key {
+			return e.kv[i+1]
+		}
+	}
+	return nil
+}
+
+// recordingLogger is a Logger that keeps every entry for inspection.
+type recordingLogger struct {
+	mu      sync.Mutex
+	entries []logEntry
+}
+
+func (l *recordingLogger) Debug(msg string, kv ...any) { l.record("debug", msg, kv) }
+func (l *recordingLogger) Error(msg string, kv ...any) { l.record("error", msg, kv) }
+
+func (l *recordingLogger) record(level, msg string, kv []any) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.entries = append(l.entries, logEntry{level, msg, kv})
+}
+
+// errors returns the error-level entries with the given message.
+func (l *recordingLogger) errors(msg string) []logEntry {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var found []logEntry
+	for _, e := range l.entries {
+		if e.level == "error" && e.msg == msg {
+			found = append(found, e)
+		}
+	}
+	return found
+}
+
+// useRecordingLogger installs a recordingLogger for the rest of the test.
+func useRecordingLogger(t *testing.T) *recordingLogger {
+	l := &recordingLogger{}
+	SetLogger(l)
+	t.Cleanup(func() { SetLogger(nil) })
+	return l
+}
+
+func TestLoggerFailedQuery(t *testing.T) {
+	db := newTestDB(t)
+	l := useRecordingLogger(t)
+	const bad = "SELECT * FROM no_such_table"
+	if _, err := Count(db, "books", ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := GetOrZero[Book](db, "SELECT * FROM books WHERE id=?", 1); err != nil {
+		t.Fatal(err)
+	}
+	if len(l.errors("query failed")) != 0 {
+		t.Fatalf("successful and no-row queries logged as failed: %+v", l.entries)
+	}
+	if _, _, err := GetOrZero[Book](db, bad); err == nil {
+		t.Fatal("bad query succeeded")
+	}
+	failed := l.errors("query failed")
+	if len(failed) != 1 || failed[0].get("sql") != bad || failed[0].get("err") == nil {
+		t.Errorf("failed query entries = %+v", failed)
+	}
+	if n := len(l.entries); n < 4 || l.entries[0].level != "debug" {
+		t.Errorf("entries = %+v, want debug logs for every query", l.entries)
+	}
+}
+
+func TestSetLoggerNil(t *testing.T) {
+	db := newTestDB(t)
+	l := useRecordingLogger(t)
+	SetLogger(nil)
+	if _, err := Count(db, "books", ""); err != nil {
+		t.Fatal(err)
+	}
+	if len(l.entries) != 0 {
+		t.Errorf("replaced logger still received %d entries", len(l.entries))
+	}
+	if _, ok := currentLogger().(nopLogger); !ok {
+		t.Errorf("SetLogger(nil) installed %T", currentLogger())
+	}
+}
@@ -4,19 +4,20 @@ import (
 	"database/sql"
 	"fmt"
 	"log"
+	"time"
 
 	"github.com/jmoiron/sqlx"
 	_ "github.com/mattn/go-sqlite3"
 )
 
 var tables = `
-CREATE TABLE authors (
+CREATE TABLE IF NOT EXISTS authors (
 	id INTEGER PRIMARY KEY AUTOINCREMENT,
 	name TEXT NOT NULL,
 	email TEXT UNIQUE NOT NULL
 );
 
-CREATE TABLE books (
+CREATE TABLE IF NOT EXISTS books (
 	id INTEGER PRIMARY KEY AUTOINCREMENT,
 	title TEXT NOT NULL,
 	author_id INTEGER,
@@ -25,7 +26,7 @@ CREATE TABLE books (
 	FOREIGN KEY(author_id) REFERENCES authors(id)
 );
 
-CREATE TABLE members (
+CREATE TABLE IF NOT EXISTS members (
 	id INTEGER PRIMARY KEY AUTOINCREMENT,
 	name TEXT NOT NULL,
 	email TEXT UNIQUE NOT NULL,
@@ -34,17 +35,22 @@ CREATE TABLE members (
 `
 
 type Author struct {
-	ID    int    `db:"id"`
-	Name  string `db:"name"`
-	Email string `db:"email"`
+	ID        int          `db:"id"`
+	Name      string       `db:"name"`
+	Email     string       `db:"email"`
+	BookCount int          `db:"book_count"` // cached, see RefreshAuthorBookCounts
+	DeletedAt sql.NullTime `db:"deleted_at"`
 }
 
 type Book struct {
 	ID            int            `db:"id"`
 	Title         string         `db:"title"`
-	AuthorID      int            `db:"author_id"`
-	PublishedYear int            `db:"published_year"`
+	AuthorID      sql.NullInt64  `db:"author_id"`
+	PublishedYear sql.NullInt64  `db:"published_year"`
 	Genre         sql.NullString `db:"genre"`
+	Metadata      Metadata       `db:"metadata"`
+	Copies        int            `db:"copies"`
+	UpdatedAt     sql.NullTime   `db:"updated_at"`
 }
 
 type Member struct {
@@ -54,6 +60,16 @@ type Member struct {
 	JoinDate string `db:"join_date"`
 }
 
+type Loan struct {
+	ID           int          `db:"id"`
+	BookID       int          `db:"book_id"`
+	MemberID     int          `db:"member_id"`
+	CheckoutDate time.Time    `db:"checkout_date"`
+	DueDate      time.Time    `db:"due_date"`
+	ReturnDate   sql.NullTime `db:"return_date"`
+	Renewals     int          `db:"renewals"`
+}
+
 func main() {
 	// DB connection
 	db, err := sqlx.Connect("sqlite3", "sqlx_demo.db")
@@ -62,17 +78,14 @@ func main() {
 	}
 
 	// Create tables
-	db.MustExec(tables)
-
-	db.MustExec("INSERT INTO authors (name, email) VALUES ($1, $2)", "J.K. Rowling", "jk.rowling@codeheim.io")
+	if err := Migrate(db); err != nil {
+		log.Fatalln(err)
+	}
 
-	// Insert data using a transaction
-	tx := db.MustBegin()
-	tx.MustExec("INSERT INTO authors (name, email) VALUES ($1, $2)", "George R.R. Martin", "george.martin@codeheim.io")
-	tx.MustExec("INSERT INTO books (title, author_id, published_year, genre) VALUES ($1, $2, $3, $4)", "Harry Potter", 1, 1997, "Fantasy")
-	tx.MustExec("INSERT INTO books (title, author_id, published_year, genre) VALUES ($1, $2, $3, $4)", "Game of Thrones", 2, 1996, "Fantasy")
-	tx.MustExec("INSERT INTO members (name, email) VALUES ($1, $2)", "John Doe", "john.doe@example.com")
-	tx.Commit()
+	// Insert the demo data; safe to repeat on an existing database
+	if err := Seed(db); err != nil {
+		log.Fatalln(err)
+	}
 
 	// Query all authors
 	var authors []Author
@@ -132,7 +145,7 @@ func main() {
 	fmt.Println("-------------------------------------------------")
 
 	// Named Query with a Struct
-	p := Book{AuthorID: 1}
+	p := Book{AuthorID: sql.NullInt64{Int64: 1, Valid: true}}
 	rows, err = db.NamedQuery(`SELECT * FROM books WHERE author_id=:author_id`, p)
 	if err != nil {
 		log.Fatalln(err)
@@ -165,9 +178,10 @@ func main() {
 
 	fmt.Println("-------------------------------------------------")
 
-	// Named Exec with a Map
-	m = map[string]interface{}{"email": "new.email@example.com", "id": 1}
-	result, err := db.NamedExec(`UPDATE authors SET email=:email WHERE id=:id`, m)
+	// Named Exec with a Map. This renames a member rather than changing an
+	// author's email, so that re-running Seed finds the same authors.
+	m = map[string]interface{}{"name": "Johnny Doe", "email": "john.doe@example.com"}
+	result, err := db.NamedExec(`UPDATE members SET name=:name WHERE email=:email`, m)
 	if err != nil {
 		log.Fatalln(err)
 	}
@@ -176,14 +190,14 @@ func main() {
 
 	fmt.Println("-------------------------------------------------")
 
-	// Insert a batch of new members
+	// Insert a batch of members, skipping any that already exist
 	members := []Member{
 		{Name: "Alice", Email: "alice@example.com"},
 		{Name: "Bob", Email: "bob@example.com"},
 		{Name: "Charlie", Email: "charlie@example.com"},
 	}
 
-	_, err = db.NamedExec(`INSERT INTO members (name, email) VALUES (:name, :email)`,
+	_, err = db.NamedExec(`INSERT OR IGNORE INTO members (name, email) VALUES (:name, :email)`,
 		members)
 
 	if err != nil {
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// openTestDB opens an empty database in a temporary file that is removed
+// when the test ends. A file is used rather than ":memory:" so that every
+// pooled connection sees the same data.
+func openTestDB(t testing.TB) *sqlx.DB {
+	t.Helper()
+	db, err := sqlx.Connect("sqlite3", filepath.Join(t.TempDir(), "test.db")+"?_busy_timeout=5000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+// newTestDB is openTestDB with every migration applied.
+func newTestDB(t testing.TB) *sqlx.DB {
+	t.Helper()
+	db := openTestDB(t)
+	if err := Migrate(db); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+// nullInt64 returns a valid sql.NullInt64 holding v.
+func nullInt64(v int64) sql.NullInt64 {
+	return sql.NullInt64{Int64: v, Valid: true}
+}
+
+// nullString returns a valid sql.NullString holding s.
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: true}
+}
+
+// count returns the single integer produced by query.
+func count(t testing.TB, db *sqlx.DB, query string, args ...interface{}) int {
+	t.Helper()
+	var n int
+	if err := db.Get(&n, query, args...); err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+// seedLoan inserts a loan directly, bypassing availability checks, and
+// returns its id. A nil returned leaves the loan active.
+func seedLoan(t testing.TB, db *sqlx.DB, bookID, memberID int, checkout, due time.Time, returned *time.Time) int {
+	t.Helper()
+	var ret interface{}
+	if returned != nil {
+		ret = returned.UTC()
+	}
+	result, err := db.Exec("INSERT INTO loans (book_id, member_id, checkout_date, due_date, return_date) VALUES (?, ?, ?, ?, ?)",
+		bookID, memberID, checkout.UTC(), due.UTC(), ret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return int(id)
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"errors"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// ErrNoIncrementalVacuum is returned by IncrementalVacuum when the database
+// was not created with auto_vacuum=INCREMENTAL.
+var ErrNoIncrementalVacuum = errors.New("auto_vacuum is not set to incremental")
+
+// Compact rebuilds the database file with VACUUM, returning the space left by
+// deleted rows to the filesystem. VACUUM cannot run inside a transaction and
+// needs temporary disk space up to the size of the database.
+func Compact(db *sqlx.DB) error {
+	_, err := db.Exec("VACUUM")
+	return err
+}
+
+// IncrementalVacuum frees all unused pages without rebuilding the file. It
+// only works on databases with auto_vacuum=INCREMENTAL (which must be set
+// before the first table is created, or followed by a VACUUM) and returns
+// ErrNoIncrementalVacuum otherwise.
+func IncrementalVacuum(db *sqlx.DB) error {
+	var mode int
+	if err := db.Get(&mode, "PRAGMA auto_vacuum"); err != nil {
+		return err
+	}
+	if mode != 2 {
+		return ErrNoIncrementalVacuum
+	}
+	// Each step of the pragma frees a page, so drain it rather than Exec.
+	rows, err := db.Query("PRAGMA incremental_vacuum")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+	}
+	return rows.Err()
+}
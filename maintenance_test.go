@@ -0,0 +1,56 @@
+package main
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// freePages returns the number of unused pages in the database file.
+func freePages(t *testing.T, db *sqlx.DB) int {
+	t.Helper()
+	return count(t, db, "PRAGMA freelist_count")
+}
+
+func TestCompact(t *testing.T) {
+	db := newTestDB(t)
+	seedManyBooks(t, db, 2000)
+	db.MustExec("DELETE FROM books")
+	if freePages(t, db) == 0 {
+		t.Fatal("delete left no free pages")
+	}
+	if err := Compact(db); err != nil {
+		t.Fatal(err)
+	}
+	if n := freePages(t, db); n != 0 {
+		t.Errorf("%d free pages after VACUUM", n)
+	}
+	if err := IncrementalVacuum(db); !errors.Is(err, ErrNoIncrementalVacuum) {
+		t.Errorf("IncrementalVacuum without auto_vacuum: %v, want ErrNoIncrementalVacuum", err)
+	}
+}
+
+func TestIncrementalVacuum(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+	db, err := sqlx.Connect("sqlite3", path+"?_busy_timeout=5000&_auto_vacuum=incremental")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if err := Migrate(db); err != nil {
+		t.Fatal(err)
+	}
+	seedManyBooks(t, db, 2000)
+	db.MustExec("DELETE FROM books")
+	if freePages(t, db) == 0 {
+		t.Fatal("delete left no free pages")
+	}
+	if err := IncrementalVacuum(db); err != nil {
+		t.Fatal(err)
+	}
+	if n := freePages(t, db); n != 0 {
+		t.Errorf("%d free pages after incremental vacuum", n)
+	}
+}
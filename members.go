@@ -0,0 +1,193 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// ErrMergeIntoSelf is returned by MergeMembers when the member to keep is
+// also listed as a duplicate.
+var ErrMergeIntoSelf = errors.New("cannot merge a member into itself")
+
+// ExistingMemberEmails reports which of emails already belong to a member.
+// The returned set only contains the emails that were found.
+func ExistingMemberEmails(db *sqlx.DB, emails []string) (map[string]bool, error) {
+	existing := map[string]bool{}
+	if len(emails) == 0 {
+		return existing, nil
+	}
+	query, args, err := sqlx.In("SELECT email FROM members WHERE email IN (?)", emails)
+	if err != nil {
+		return nil, err
+	}
+	var found []string
+	if err := db.Select(&found, db.Rebind(query), args...); err != nil {
+		return nil, err
+	}
+	for _, email := range found {
+		existing[email] = true
+	}
+	return existing, nil
+}
+
+// ChangeMemberEmail sets a member's email, recording the previous address in
+// member_email_history within the same transaction. It returns
+// ErrInvalidEmail for a malformed address, ErrDuplicateEmail if another
+// member already uses it, and sql.ErrNoRows if the member does not exist.
+func ChangeMemberEmail(db *sqlx.DB, memberID int, newEmail string) error {
+	if err := ValidateEmail(newEmail); err != nil {
+		return err
+	}
+	return InTx(db, func(tx *sqlx.Tx) error {
+		_, err := changeMemberEmail(tx, memberID, newEmail)
+		return err
+	})
+}
+
+// UpdateMemberEmails applies several email changes, keyed by member id, in a
+// single transaction and returns how many members got a new address. Every
+// email is validated first; if any is invalid, collides with another
+// member's, or belongs to a missing member, nothing is changed and the error
+// names the member and wraps ErrInvalidEmail, ErrDuplicateEmail or
+// sql.ErrNoRows. Changes are applied in id order, so two members cannot swap
+// addresses in one call.
+func UpdateMemberEmails(db *sqlx.DB, updates map[int]string) (int64, error) {
+	ids := make([]int, 0, len(updates))
+	for id, email := range updates {
+		if err := ValidateEmail(email); err != nil {
+			return 0, fmt.Errorf("member %d: %w", id, err)
+		}
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	return InTxValue(db, func(tx *sqlx.Tx) (int64, error) {
+		var changed int64
+		for _, id := range ids {
+			ok, err := changeMemberEmail(tx, id, updates[id])
+			if err != nil {
+				return 0, fmt.Errorf("member %d: %w", id, err)
+			}
+			if ok {
+				changed++
+			}
+		}
+		return changed, nil
+	})
+}
+
+// changeMemberEmail sets a member's email within tx and records the old one
+// in member_email_history. It reports whether the email actually changed.
+func changeMemberEmail(tx *sqlx.Tx, memberID int, newEmail string) (bool, error) {
+	var oldEmail string
+	if err := tx.Get(&oldEmail, "SELECT email FROM members WHERE id=?", memberID); err != nil {
+		return false, err
+	}
+	if oldEmail == newEmail {
+		return false, nil
+	}
+	if _, err := tx.Exec("UPDATE members SET email=? WHERE id=?", newEmail, memberID); err != nil {
+		if isUniqueViolation(err) {
+			return false, ErrDuplicateEmail
+		}
+		return false, err
+	}
+	_, err := tx.Exec("INSERT INTO member_email_history (member_id, old_email) VALUES (?, ?)", memberID, oldEmail)
+	return err == nil, err
+}
+
+// MergeMembers folds the duplicate members mergeIDs into keepID: their loans,
+// archived loans, reservations, fines and email history are reassigned to
+// keepID and the duplicates are deleted, all in one transaction. It returns
+// sql.ErrNoRows if keepID does not exist.
+func MergeMembers(db *sqlx.DB, keepID int, mergeIDs []int) error {
+	for _, id := range mergeIDs {
+		if id == keepID {
+			return ErrMergeIntoSelf
+		}
+	}
+	if len(mergeIDs) == 0 {
+		return nil
+	}
+	return InTx(db, func(tx *sqlx.Tx) error {
+		var keep int
+		if err := tx.Get(&keep, "SELECT id FROM members WHERE id=?", keepID); err != nil {
+			return err
+		}
+		for _, table := range []string{"loans", "loans_archive", "reservations", "fines", "member_email_history"} {
+			query, args, err := sqlx.In("UPDATE "+table+" SET member_id=? WHERE member_id IN (?)", keepID, mergeIDs)
+			if err != nil {
+				return err
+			}
+			if _, err := tx.Exec(tx.Rebind(query), args...); err != nil {
+				return err
+			}
+		}
+		query, args, err := sqlx.In("DELETE FROM members WHERE id IN (?)", mergeIDs)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(tx.Rebind(query), args...)
+		return err
+	})
+}
+
+// FirstOrCreateMember returns the member with the given email, creating it
+// with name if it does not exist yet. created reports whether a new member
+// was inserted; an existing member keeps its current name.
+func FirstOrCreateMember(db *sqlx.DB, name, email string) (member Member, created bool, err error) {
+	if err := ValidateEmail(email); err != nil {
+		return Member{}, false, err
+	}
+	err = InTx(db, func(tx *sqlx.Tx) error {
+		result, err := tx.Exec("INSERT OR IGNORE INTO members (name, email) VALUES (?, ?)", name, email)
+		if err != nil {
+			return err
+		}
+		n, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		created = n > 0
+		return tx.Get(&member, "SELECT * FROM members WHERE email=?", email)
+	})
+	if err != nil {
+		return Member{}, false, err
+	}
+	return member, created, nil
+}
+
+// EmailInUse reports whether email, compared case-insensitively, belongs to
+// an author or a member, and which: "author", "member", or "" when unused.
+// An email used by both is reported as "author". A soft-deleted author still
+// holds its email, so it counts as a use.
+func EmailInUse(db *sqlx.DB, email string) (bool, string, error) {
+	var kinds []string
+	err := db.Select(&kinds, `SELECT 'author' AS kind FROM authors WHERE LOWER(email) = LOWER(?)
+		UNION
+		SELECT 'member' AS kind FROM members WHERE LOWER(email) = LOWER(?)
+		ORDER BY kind`, email, email)
+	if err != nil || len(kinds) == 0 {
+		return false, "", err
+	}
+	return true, kinds[0], nil
+}
+
+// DomainCount is the number of members whose email is at Domain.
+type DomainCount struct {
+	Domain string `db:"domain"`
+	Count  int    `db:"count"`
+}
+
+// MemberCountByEmailDomain counts members per email domain, most common
+// first and then alphabetically. Domains are compared case-insensitively and
+// reported in lower case.
+func MemberCountByEmailDomain(db *sqlx.DB) ([]DomainCount, error) {
+	counts := []DomainCount{}
+	err := db.Select(&counts, `SELECT LOWER(substr(email, instr(email, '@') + 1)) AS domain, COUNT(*) AS count
+		FROM members WHERE instr(email, '@') > 0
+		GROUP BY domain ORDER BY count DESC, domain`)
+	return counts, err
+}
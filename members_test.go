@@ -0,0 +1,247 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestExistingMemberEmails(t *testing.T) {
+	db := newTestDB(t)
+	db.MustExec("INSERT INTO members (name, email) VALUES ('A', 'a@example.com'), ('B', 'b@example.com')")
+
+	got, err := ExistingMemberEmails(db, []string{"a@example.com", "new@example.com", "b@example.com", "other@example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]bool{"a@example.com": true, "b@example.com": true}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ExistingMemberEmails = %v, want %v", got, want)
+	}
+
+	got, err = ExistingMemberEmails(db, nil)
+	if err != nil || len(got) != 0 {
+		t.Errorf("no emails: %v, %v", got, err)
+	}
+}
+
+func TestChangeMemberEmail(t *testing.T) {
+	db := newTestDB(t)
+	db.MustExec("INSERT INTO members (id, name, email) VALUES (1, 'A', 'a@example.com'), (2, 'B', 'b@example.com')")
+
+	if err := ChangeMemberEmail(db, 1, "a2@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	var email string
+	if err := db.Get(&email, "SELECT email FROM members WHERE id=1"); err != nil {
+		t.Fatal(err)
+	}
+	if email != "a2@example.com" {
+		t.Errorf("email = %q after change", email)
+	}
+	var old string
+	if err := db.Get(&old, "SELECT old_email FROM member_email_history WHERE member_id=1"); err != nil {
+		t.Fatal(err)
+	}
+	if old != "a@example.com" {
+		t.Errorf("history old_email = %q", old)
+	}
+}
+
+func TestChangeMemberEmailRejected(t *testing.T) {
+	db := newTestDB(t)
+	db.MustExec("INSERT INTO members (id, name, email) VALUES (1, 'A', 'a@example.com'), (2, 'B', 'b@example.com')")
+
+	tests := []struct {
+		id    int
+		email string
+		want  error
+	}{
+		{1, "b@example.com", ErrDuplicateEmail},
+		{1, "not-an-email", ErrInvalidEmail},
+		{99, "z@example.com", sql.ErrNoRows},
+	}
+	for _, tt := range tests {
+		if err := ChangeMemberEmail(db, tt.id, tt.email); !errors.Is(err, tt.want) {
+			t.Errorf("ChangeMemberEmail(%d, %q) = %v, want %v", tt.id, tt.email, err, tt.want)
+		}
+	}
+	var email string
+	if err := db.Get(&email, "SELECT email FROM members WHERE id=1"); err != nil {
+		t.Fatal(err)
+	}
+	if email != "a@example.com" {
+		t.Errorf("email changed to %q", email)
+	}
+	if n := count(t, db, "SELECT COUNT(*) FROM member_email_history"); n != 0 {
+		t.Errorf("%d history rows after rejected changes", n)
+	}
+}
+
+func TestMergeMembers(t *testing.T) {
+	db := newTestDB(t)
+	db.MustExec(`INSERT INTO members (id, name, email) VALUES
+		(1, 'Ann', 'ann@example.com'), (2, 'Ann L', 'ann.l@example.com'), (3, 'A. L.', 'al@example.com'), (4, 'Bob', 'bob@example.com')`)
+	now := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	seedLoan(t, db, 1, 1, now, now, nil)
+	seedLoan(t, db, 2, 2, now, now, nil)
+	seedLoan(t, db, 3, 3, now, now, nil)
+	bobLoan := seedLoan(t, db, 4, 4, now, now, nil)
+	db.MustExec("INSERT INTO reservations (book_id, member_id) VALUES (5, 2), (6, 3), (7, 4)")
+
+	if err := MergeMembers(db, 1, []int{2, 3}); err != nil {
+		t.Fatal(err)
+	}
+	if n := count(t, db, "SELECT COUNT(*) FROM loans WHERE member_id=1"); n != 3 {
+		t.Errorf("kept member has %d loans, want 3", n)
+	}
+	if n := count(t, db, "SELECT COUNT(*) FROM reservations WHERE member_id=1"); n != 2 {
+		t.Errorf("kept member has %d reservations, want 2", n)
+	}
+	if n := count(t, db, "SELECT COUNT(*) FROM members WHERE id IN (2, 3)"); n != 0 {
+		t.Errorf("%d duplicates remain", n)
+	}
+	if n := count(t, db, "SELECT COUNT(*) FROM loans WHERE id=? AND member_id=4", bobLoan); n != 1 {
+		t.Error("unrelated member's loan was moved")
+	}
+}
+
+func TestMergeMembersRejected(t *testing.T) {
+	db := newTestDB(t)
+	db.MustExec("INSERT INTO members (id, name, email) VALUES (1, 'Ann', 'ann@example.com'), (2, 'Ann L', 'ann.l@example.com')")
+	if err := MergeMembers(db, 1, []int{2, 1}); !errors.Is(err, ErrMergeIntoSelf) {
+		t.Errorf("merging into self: %v, want ErrMergeIntoSelf", err)
+	}
+	if err := MergeMembers(db, 9, []int{2}); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("missing keep member: %v, want sql.ErrNoRows", err)
+	}
+	if n := count(t, db, "SELECT COUNT(*) FROM members"); n != 2 {
+		t.Errorf("%d members after rejected merges, want 2", n)
+	}
+}
+
+func TestMergeMembersArchivedLoans(t *testing.T) {
+	db := newTestDB(t)
+	db.MustExec("INSERT INTO members (id, name, email) VALUES (1, 'Ann', 'ann@example.com'), (2, 'Ann L', 'ann.l@example.com')")
+	checkout := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	returned := checkout.AddDate(0, 0, 7)
+	seedLoan(t, db, 1, 1, checkout, returned, nil)
+	seedLoan(t, db, 2, 2, checkout, returned, &returned)
+	if _, err := ArchiveReturnedLoans(db, returned.Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := MergeMembers(db, 1, []int{2}); err != nil {
+		t.Fatal(err)
+	}
+	if n := count(t, db, "SELECT COUNT(*) FROM loans_archive WHERE member_id=1"); n != 1 {
+		t.Errorf("kept member has %d archived loans, want 1", n)
+	}
+	if total, err := MemberTotalBorrowed(db, 1); err != nil || total != 2 {
+		t.Errorf("total borrowed = %d, %v, want 2", total, err)
+	}
+}
+
+func TestFirstOrCreateMember(t *testing.T) {
+	db := newTestDB(t)
+	m, created, err := FirstOrCreateMember(db, "Ann", "ann@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !created || m.ID == 0 || m.Name != "Ann" {
+		t.Errorf("first call: %+v, created=%v", m, created)
+	}
+	again, created, err := FirstOrCreateMember(db, "Someone Else", "ann@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if created || again.ID != m.ID || again.Name != "Ann" {
+		t.Errorf("second call: %+v, created=%v, want existing member %d", again, created, m.ID)
+	}
+	if _, _, err := FirstOrCreateMember(db, "Bad", "nope"); !errors.Is(err, ErrInvalidEmail) {
+		t.Errorf("invalid email: %v, want ErrInvalidEmail", err)
+	}
+	if n := count(t, db, "SELECT COUNT(*) FROM members"); n != 1 {
+		t.Errorf("%d members, want 1", n)
+	}
+}
+
+func TestEmailInUse(t *testing.T) {
+	db := newTestDB(t)
+	db.MustExec("INSERT INTO authors (name, email) VALUES ('Ann', 'ann@example.com'), ('Both', 'both@example.com')")
+	db.MustExec("INSERT INTO members (name, email) VALUES ('Mia', 'mia@example.com'), ('Both', 'both@example.com')")
+	db.MustExec("INSERT INTO authors (name, email, deleted_at) VALUES ('Gone', 'gone@example.com', ?)", time.Now())
+	tests := []struct {
+		email string
+		inUse bool
+		kind  string
+	}{
+		{"ann@example.com", true, "author"},
+		{"MIA@Example.com", true, "member"},
+		{"both@example.com", true, "author"},
+		{"gone@example.com", true, "author"},
+		{"nobody@example.com", false, ""},
+	}
+	for _, tt := range tests {
+		inUse, kind, err := EmailInUse(db, tt.email)
+		if err != nil || inUse != tt.inUse || kind != tt.kind {
+			t.Errorf("EmailInUse(%q) = %v, %q, %v, want %v, %q", tt.email, inUse, kind, err, tt.inUse, tt.kind)
+		}
+	}
+}
+
+func TestUpdateMemberEmails(t *testing.T) {
+	db := newTestDB(t)
+	db.MustExec("INSERT INTO members (id, name, email) VALUES (1, 'A', 'a@example.com'), (2, 'B', 'b@example.com'), (3, 'C', 'c@example.com')")
+	n, err := UpdateMemberEmails(db, map[int]string{1: "a@new.example", 2: "b@example.com", 3: "c@new.example"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Errorf("changed %d members, want 2", n)
+	}
+	if got := count(t, db, "SELECT COUNT(*) FROM member_email_history"); got != 2 {
+		t.Errorf("%d history rows, want 2", got)
+	}
+}
+
+func TestUpdateMemberEmailsAllOrNothing(t *testing.T) {
+	db := newTestDB(t)
+	db.MustExec("INSERT INTO members (id, name, email) VALUES (1, 'A', 'a@example.com'), (2, 'B', 'b@example.com')")
+	tests := []struct {
+		updates map[int]string
+		want    error
+	}{
+		{map[int]string{1: "a@new.example", 2: "bad"}, ErrInvalidEmail},
+		{map[int]string{1: "a@new.example", 2: "a@new.example"}, ErrDuplicateEmail},
+		{map[int]string{1: "b@example.com", 2: "a@example.com"}, ErrDuplicateEmail}, // no swaps
+		{map[int]string{1: "a@new.example", 9: "z@example.com"}, sql.ErrNoRows},
+	}
+	for _, tt := range tests {
+		if _, err := UpdateMemberEmails(db, tt.updates); !errors.Is(err, tt.want) {
+			t.Errorf("UpdateMemberEmails(%v): %v, want %v", tt.updates, err, tt.want)
+		}
+	}
+	if got := count(t, db, "SELECT COUNT(*) FROM members WHERE email IN ('a@example.com', 'b@example.com')"); got != 2 {
+		t.Error("a failed batch changed emails")
+	}
+	if got := count(t, db, "SELECT COUNT(*) FROM member_email_history"); got != 0 {
+		t.Errorf("%d history rows after failed batches, want 0", got)
+	}
+}
+
+func TestMemberCountByEmailDomain(t *testing.T) {
+	db := newTestDB(t)
+	db.MustExec(`INSERT INTO members (name, email) VALUES ('A', 'a@Example.com'), ('B', 'b@example.COM'),
+		('C', 'c@other.org'), ('D', 'd@abc.net'), ('E', 'e@abc.net'), ('F', 'no-at-sign')`)
+	counts, err := MemberCountByEmailDomain(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []DomainCount{{"abc.net", 2}, {"example.com", 2}, {"other.org", 1}}
+	if !reflect.DeepEqual(counts, want) {
+		t.Errorf("counts = %+v, want %+v", counts, want)
+	}
+}
@@ -0,0 +1,127 @@
+package main
+
+import "github.com/jmoiron/sqlx"
+
+// migrations holds the schema changes in order; migration N is
+// migrations[N-1]. Append new entries and never edit ones already applied.
+var migrations = []string{
+	// The original demo created these tables without recording a version,
+	// so migration 1 uses IF NOT EXISTS and adopts such a database.
+	tables,
+	`
+CREATE TABLE loans (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	book_id INTEGER NOT NULL,
+	member_id INTEGER NOT NULL,
+	checkout_date DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	due_date DATETIME NOT NULL,
+	return_date DATETIME,
+	FOREIGN KEY(book_id) REFERENCES books(id),
+	FOREIGN KEY(member_id) REFERENCES members(id)
+);
+`,
+	`
+CREATE TABLE member_email_history (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	member_id INTEGER NOT NULL,
+	old_email TEXT NOT NULL,
+	changed_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	FOREIGN KEY(member_id) REFERENCES members(id)
+);
+`,
+	`
+CREATE TABLE sequences (
+	name TEXT PRIMARY KEY,
+	value INTEGER NOT NULL
+);
+`,
+	`CREATE INDEX idx_loans_active_book ON loans(book_id) WHERE return_date IS NULL;`,
+	`
+CREATE TABLE fines (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	member_id INTEGER NOT NULL,
+	loan_id INTEGER,
+	amount INTEGER NOT NULL,
+	paid_at DATETIME,
+	FOREIGN KEY(member_id) REFERENCES members(id),
+	FOREIGN KEY(loan_id) REFERENCES loans(id)
+);
+`,
+	`
+CREATE TABLE reservations (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	book_id INTEGER NOT NULL,
+	member_id INTEGER NOT NULL,
+	reserved_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	fulfilled_at DATETIME,
+	FOREIGN KEY(book_id) REFERENCES books(id),
+	FOREIGN KEY(member_id) REFERENCES members(id)
+);
+`,
+	`ALTER TABLE authors ADD COLUMN book_count INTEGER NOT NULL DEFAULT 0;`,
+	`ALTER TABLE books ADD COLUMN metadata TEXT;`,
+	`CREATE UNIQUE INDEX idx_authors_email_lower ON authors(LOWER(email));`,
+	`ALTER TABLE loans ADD COLUMN renewals INTEGER NOT NULL DEFAULT 0;`,
+	`
+CREATE TABLE loans_archive (
+	id INTEGER PRIMARY KEY,
+	book_id INTEGER NOT NULL,
+	member_id INTEGER NOT NULL,
+	checkout_date DATETIME NOT NULL,
+	due_date DATETIME NOT NULL,
+	return_date DATETIME NOT NULL,
+	renewals INTEGER NOT NULL DEFAULT 0,
+	archived_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+`,
+	`ALTER TABLE books ADD COLUMN copies INTEGER NOT NULL DEFAULT 1;`,
+	`ALTER TABLE books ADD COLUMN updated_at DATETIME;`,
+	`ALTER TABLE authors ADD COLUMN deleted_at DATETIME;`,
+}
+
+// Migrate applies all pending migrations.
+func Migrate(db *sqlx.DB) error {
+	return MigrateTo(db, len(migrations))
+}
+
+// MigrateTo applies pending migrations up to and including version. Each
+// migration runs in its own transaction together with its bookkeeping row
+// in schema_migrations.
+func MigrateTo(db *sqlx.DB, version int) error {
+	if _, err := db.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INTEGER PRIMARY KEY,
+		applied_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+	)`); err != nil {
+		return err
+	}
+	current, err := SchemaVersion(db)
+	if err != nil {
+		return err
+	}
+	for v := current + 1; v <= version && v <= len(migrations); v++ {
+		err := InTx(db, func(tx *sqlx.Tx) error {
+			if _, err := tx.Exec(migrations[v-1]); err != nil {
+				return err
+			}
+			_, err := tx.Exec("INSERT INTO schema_migrations (version) VALUES (?)", v)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SchemaVersion returns the highest applied migration number, or 0 if no
+// migration has been applied yet.
+func SchemaVersion(db *sqlx.DB) (int, error) {
+	var exists bool
+	err := db.Get(&exists, "SELECT COUNT(*) > 0 FROM sqlite_master WHERE type='table' AND name='schema_migrations'")
+	if err != nil || !exists {
+		return 0, err
+	}
+	var version int
+	err = db.Get(&version, "SELECT COALESCE(MAX(version), 0) FROM schema_migrations")
+	return version, err
+}
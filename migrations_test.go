@@ -0,0 +1,53 @@
+package main
+
+import "testing"
+
+func TestSchemaVersion(t *testing.T) {
+	db := openTestDB(t)
+	if v, err := SchemaVersion(db); err != nil || v != 0 {
+		t.Errorf("fresh database: version %d, %v, want 0", v, err)
+	}
+	if err := MigrateTo(db, 1); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := SchemaVersion(db); err != nil || v != 1 {
+		t.Errorf("after one migration: version %d, %v, want 1", v, err)
+	}
+	if err := Migrate(db); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := SchemaVersion(db); err != nil || v != len(migrations) {
+		t.Errorf("after all migrations: version %d, %v, want %d", v, err, len(migrations))
+	}
+	if err := Migrate(db); err != nil {
+		t.Errorf("re-running Migrate: %v", err)
+	}
+}
+
+// TestMigratePreMigrationDatabase checks that a database created by the
+// original demo, which ran the table DDL directly, can be migrated.
+func TestMigratePreMigrationDatabase(t *testing.T) {
+	db := openTestDB(t)
+	db.MustExec(`
+CREATE TABLE authors (id INTEGER PRIMARY KEY AUTOINCREMENT, name TEXT NOT NULL, email TEXT UNIQUE NOT NULL);
+CREATE TABLE books (id INTEGER PRIMARY KEY AUTOINCREMENT, title TEXT NOT NULL, author_id INTEGER, published_year INTEGER, genre TEXT,
+	FOREIGN KEY(author_id) REFERENCES authors(id));
+CREATE TABLE members (id INTEGER PRIMARY KEY AUTOINCREMENT, name TEXT NOT NULL, email TEXT UNIQUE NOT NULL,
+	join_date TEXT NOT NULL DEFAULT CURRENT_DATE);
+INSERT INTO authors (name, email) VALUES ('J.K. Rowling', 'jk.rowling@codeheim.io');
+INSERT INTO books (title, author_id, published_year, genre) VALUES ('Harry Potter', 1, 1997, 'Fantasy');
+`)
+	if err := Migrate(db); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := SchemaVersion(db); err != nil || v != len(migrations) {
+		t.Errorf("version %d, %v, want %d", v, err, len(migrations))
+	}
+	var b Book
+	if err := db.Get(&b, "SELECT * FROM books"); err != nil {
+		t.Fatal(err)
+	}
+	if b.Title != "Harry Potter" || b.Copies != 1 {
+		t.Errorf("existing book after migration: %+v", b)
+	}
+}
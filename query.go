@@ -0,0 +1,184 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// TimedSelect runs db.Select and returns how long it took, logging a warning
+// if the elapsed time exceeds threshold; see logSlowQuery.
+func TimedSelect(db *sqlx.DB, dest interface{}, threshold time.Duration, query string, args ...interface{}) (time.Duration, error) {
+	start := time.Now()
+	err := db.Select(dest, query, args...)
+	elapsed := time.Since(start)
+	logQuery(query, err)
+	if elapsed > threshold {
+		logSlowQuery(query, elapsed, threshold)
+	}
+	return elapsed, err
+}
+
+// ConcurrentSelect runs query from n goroutines sharing db and returns the
+// joined errors of all runs, or nil if every run succeeded. Each goroutine
+// reads its rows to completion and closes them, so connections are returned
+// to the pool. Note that a plain ":memory:" DSN gives every pooled
+// connection its own empty database; use a file or a shared cache DSN.
+func ConcurrentSelect(db *sqlx.DB, n int, query string) error {
+	if n < 0 {
+		return errors.New("n must not be negative")
+	}
+	errs := make([]error, n)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = drainRows(db, query)
+			logQuery(query, errs[i])
+		}(i)
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+// drainRows runs query and scans every row, discarding the values.
+func drainRows(db *sqlx.DB, query string) error {
+	rows, err := db.Queryx(query)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		row := map[string]interface{}{}
+		if err := rows.MapScan(row); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// GetOrZero runs db.Get into a new T. A missing row is not an error: it
+// returns the zero value with found set to false.
+func GetOrZero[T any](db *sqlx.DB, query string, args ...interface{}) (T, bool, error) {
+	var dest T
+	err := db.Get(&dest, query, args...)
+	logQuery(query, err)
+	if errors.Is(err, sql.ErrNoRows) {
+		return dest, false, nil
+	}
+	if err != nil {
+		var zero T
+		return zero, false, err
+	}
+	return dest, true, nil
+}
+
+// GetMap runs a single-row query and scans the row into a map keyed by
+// column name, converting []byte values to strings. A missing row returns
+// found=false with a nil error.
+func GetMap(db *sqlx.DB, query string, args ...interface{}) (map[string]interface{}, bool, error) {
+	row := map[string]interface{}{}
+	err := db.QueryRowx(query, args...).MapScan(row)
+	logQuery(query, err)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	for k, v := range row {
+		if b, ok := v.([]byte); ok {
+			row[k] = string(b)
+		}
+	}
+	return row, true, nil
+}
+
+// NamedIn binds a named query against arg and expands any slice arguments
+// into IN lists, returning a query rebound for db along with its args. For
+// example, with arg {"genre": "Fantasy", "author_ids": []int{1, 2}}:
+//
+//	SELECT * FROM books WHERE genre=:genre AND author_id IN (:author_ids)
+//
+// becomes "... WHERE genre=? AND author_id IN (?, ?)" with args
+// ["Fantasy", 1, 2].
+func NamedIn(db *sqlx.DB, query string, arg interface{}) (string, []interface{}, error) {
+	query, args, err := sqlx.Named(query, arg)
+	if err != nil {
+		return "", nil, err
+	}
+	query, args, err = sqlx.In(query, args...)
+	if err != nil {
+		return "", nil, err
+	}
+	return db.Rebind(query), args, nil
+}
+
+// likeEscaper escapes the LIKE wildcards % and _ (and the escape character
+// itself) for use with ESCAPE '\'.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// escapeLike returns s with LIKE wildcards escaped, so that it matches
+// literally in a pattern used with ESCAPE '\'.
+func escapeLike(s string) string {
+	return likeEscaper.Replace(s)
+}
+
+// ExecResult is the outcome of ExecReport.
+type ExecResult struct {
+	RowsAffected int64
+	LastInsertID int64
+}
+
+// ExecReport runs db.Exec and collects its result. LastInsertID is only
+// filled in for INSERT and REPLACE statements, since SQLite otherwise
+// reports the id of an earlier insert on the connection. Drivers that do not
+// support RowsAffected or LastInsertId leave the field at zero rather than
+// failing the call.
+func ExecReport(db *sqlx.DB, query string, args ...interface{}) (ExecResult, error) {
+	result, err := db.Exec(query, args...)
+	logQuery(query, err)
+	if err != nil {
+		return ExecResult{}, err
+	}
+	var report ExecResult
+	if n, err := result.RowsAffected(); err == nil {
+		report.RowsAffected = n
+	}
+	if fields := strings.Fields(query); len(fields) > 0 && isInsertVerb(fields[0]) {
+		if id, err := result.LastInsertId(); err == nil {
+			report.LastInsertID = id
+		}
+	}
+	return report, nil
+}
+
+// isInsertVerb reports whether a statement's first word makes it an INSERT
+// or REPLACE.
+func isInsertVerb(word string) bool {
+	verb := strings.ToUpper(word)
+	return verb == "INSERT" || verb == "REPLACE"
+}
+
+// Count returns the number of rows in table matching where, a fragment such
+// as "genre=? AND published_year>?" whose placeholders are bound to args.
+// An empty where counts every row. table must be a known table; where is
+// inserted verbatim, so it must never contain user input.
+func Count(db *sqlx.DB, table string, where string, args ...interface{}) (int, error) {
+	if err := checkTable(table); err != nil {
+		return 0, err
+	}
+	query := "SELECT COUNT(*) FROM " + table
+	if where != "" {
+		query += " WHERE " + where
+	}
+	var n int
+	err := db.Get(&n, db.Rebind(query), args...)
+	logQuery(query, err)
+	return n, err
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestTimedSelectSlow(t *testing.T) {
+	db := newTestDB(t)
+	l := useRecordingLogger(t)
+
+	var titles []string
+	const query = "SELECT title FROM books"
+	elapsed, err := TimedSelect(db, &titles, 1, query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if elapsed <= 0 {
+		t.Errorf("elapsed = %v, want > 0", elapsed)
+	}
+	slow := l.errors("slow query")
+	if len(slow) != 1 || slow[0].get("sql") != query || slow[0].get("elapsed") != elapsed {
+		t.Errorf("slow query entries = %+v, want one for the query", slow)
+	}
+}
+
+func TestTimedSelectSlowDefaultLogger(t *testing.T) {
+	db := newTestDB(t)
+	SetLogger(nil)
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+
+	var titles []string
+	const query = "SELECT title FROM books"
+	if _, err := TimedSelect(db, &titles, 1, query); err != nil {
+		t.Fatal(err)
+	}
+	if out := buf.String(); !strings.Contains(out, "slow query") || !strings.Contains(out, query) {
+		t.Errorf("standard log output = %q, want a slow query line", out)
+	}
+}
+
+func TestTimedSelectFast(t *testing.T) {
+	db := newTestDB(t)
+	l := useRecordingLogger(t)
+
+	var titles []string
+	if _, err := TimedSelect(db, &titles, time.Hour, "SELECT title FROM books"); err != nil {
+		t.Fatal(err)
+	}
+	if slow := l.errors("slow query"); len(slow) != 0 {
+		t.Errorf("warning logged for a query under the threshold: %+v", slow)
+	}
+}
+
+func TestConcurrentSelect(t *testing.T) {
+	db := newTestDB(t)
+	for i := 0; i < 200; i++ {
+		db.MustExec("INSERT INTO books (title, published_year) VALUES (?, ?)", fmt.Sprintf("Book %03d", i), 1900+i)
+	}
+	if err := ConcurrentSelect(db, 50, "SELECT * FROM books"); err != nil {
+		t.Fatal(err)
+	}
+	if err := ConcurrentSelect(db, 5, "SELECT * FROM no_such_table"); err == nil {
+		t.Error("want an error for a bad query")
+	}
+	if err := ConcurrentSelect(db, 0, "SELECT * FROM books"); err != nil {
+		t.Errorf("zero runs: %v", err)
+	}
+	if err := ConcurrentSelect(db, -1, "SELECT * FROM books"); err == nil {
+		t.Error("want an error for a negative n")
+	}
+}
+
+// TestConcurrentHelpers runs the query helpers from many goroutines against
+// one *sqlx.DB while the logger is swapped, and checks every goroutine sees
+// the same, complete data. Run with -race.
+func TestConcurrentHelpers(t *testing.T) {
+	db := newTestDB(t)
+	for i := 0; i < 100; i++ {
+		db.MustExec("INSERT INTO books (title, published_year) VALUES (?, ?)", fmt.Sprintf("Book %03d", i), 1900+i)
+	}
+	var want []Book
+	if err := db.Select(&want, "SELECT * FROM books ORDER BY id"); err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 300)
+	for i := 0; i < 100; i++ {
+		wg.Add(3)
+		go func() {
+			defer wg.Done()
+			var got []Book
+			if _, err := TimedSelect(db, &got, time.Hour, "SELECT * FROM books ORDER BY id"); err != nil {
+				errs <- err
+			} else if !reflect.DeepEqual(got, want) {
+				errs <- fmt.Errorf("got %d books that differ from the %d expected", len(got), len(want))
+			}
+		}()
+		go func(i int) {
+			defer wg.Done()
+			b, found, err := GetOrZero[Book](db, "SELECT * FROM books WHERE id=?", want[i].ID)
+			if err != nil || !found || !reflect.DeepEqual(b, want[i]) {
+				errs <- fmt.Errorf("GetOrZero(%d) = %+v, %v, %v", want[i].ID, b, found, err)
+			}
+		}(i)
+		go func() {
+			defer wg.Done()
+			SetLogger(nil)
+			if n, err := Count(db, "books", ""); err != nil || n != len(want) {
+				errs <- fmt.Errorf("Count = %d, %v", n, err)
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+}
+
+func TestGetOrZero(t *testing.T) {
+	db := newTestDB(t)
+	db.MustExec("INSERT INTO authors (id, name, email) VALUES (1, 'Ann', 'ann@example.com')")
+
+	a, found, err := GetOrZero[Author](db, "SELECT * FROM authors WHERE id=?", 1)
+	if err != nil || !found || a.Name != "Ann" {
+		t.Errorf("found row: %+v, %v, %v", a, found, err)
+	}
+	a, found, err = GetOrZero[Author](db, "SELECT * FROM authors WHERE id=?", 2)
+	if err != nil || found || a != (Author{}) {
+		t.Errorf("missing row: %+v, %v, %v", a, found, err)
+	}
+	a, found, err = GetOrZero[Author](db, "SELECT * FROM no_such_table")
+	if err == nil || found || a != (Author{}) {
+		t.Errorf("bad query: %+v, %v, %v", a, found, err)
+	}
+}
+
+func TestGetMap(t *testing.T) {
+	db := newTestDB(t)
+	db.MustExec("INSERT INTO books (id, title, published_year, genre) VALUES (1, 'Dune', 1965, NULL)")
+
+	row, found, err := GetMap(db, "SELECT id, title, published_year, genre FROM books WHERE id=?", 1)
+	if err != nil || !found {
+		t.Fatalf("found row: %v, %v", found, err)
+	}
+	want := map[string]interface{}{"id": int64(1), "title": "Dune", "published_year": int64(1965), "genre": nil}
+	if !reflect.DeepEqual(row, want) {
+		t.Errorf("GetMap = %#v, want %#v", row, want)
+	}
+	row, found, err = GetMap(db, "SELECT CAST('raw' AS BLOB) AS b")
+	if err != nil || !found || row["b"] != "raw" {
+		t.Errorf("[]byte value not converted: %#v, %v", row, err)
+	}
+
+	row, found, err = GetMap(db, "SELECT * FROM books WHERE id=?", 2)
+	if err != nil || found || row != nil {
+		t.Errorf("missing row: %v, %v, %v", row, found, err)
+	}
+}
+
+func TestNamedIn(t *testing.T) {
+	db := newTestDB(t)
+	query, args, err := NamedIn(db, "SELECT * FROM books WHERE genre=:genre AND author_id IN (:author_ids)",
+		map[string]interface{}{"genre": "Fantasy", "author_ids": []int{1, 2}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "SELECT * FROM books WHERE genre=? AND author_id IN (?, ?)"; query != want {
+		t.Errorf("query = %q, want %q", query, want)
+	}
+	if want := []interface{}{"Fantasy", 1, 2}; !reflect.DeepEqual(args, want) {
+		t.Errorf("args = %v, want %v", args, want)
+	}
+
+	db.MustExec("INSERT INTO books (title, author_id, genre) VALUES ('A', 1, 'Fantasy'), ('B', 2, 'Fantasy'), ('C', 3, 'Fantasy'), ('D', 1, 'Drama')")
+	var titles []string
+	query, args, _ = NamedIn(db, "SELECT title FROM books WHERE genre=:genre AND author_id IN (:author_ids) ORDER BY title",
+		map[string]interface{}{"genre": "Fantasy", "author_ids": []int{1, 2}})
+	if err := db.Select(&titles, query, args...); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"A", "B"}; !reflect.DeepEqual(titles, want) {
+		t.Errorf("titles = %v, want %v", titles, want)
+	}
+}
+
+func TestExecReport(t *testing.T) {
+	db := newTestDB(t)
+	r, err := ExecReport(db, "INSERT INTO authors (name, email) VALUES ('Ann', 'ann@example.com'), ('Bob', 'bob@example.com')")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.RowsAffected != 2 || r.LastInsertID != 2 {
+		t.Errorf("insert: %+v, want 2 rows, last id 2", r)
+	}
+	r, err = ExecReport(db, "UPDATE authors SET name=upper(name) WHERE id=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r != (ExecResult{RowsAffected: 1}) {
+		t.Errorf("update: %+v, want 1 row and no insert id", r)
+	}
+	r, err = ExecReport(db, "INSERT\nINTO authors (name, email) VALUES ('Cy', 'cy@example.com')")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.LastInsertID != 3 {
+		t.Errorf("insert split over lines: %+v, want last id 3", r)
+	}
+	r, err = ExecReport(db, "\treplace\tINTO authors (id, name, email) VALUES (4, 'Di', 'di@example.com')")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.LastInsertID != 4 {
+		t.Errorf("tab-separated replace: %+v, want last id 4", r)
+	}
+	if _, err := ExecReport(db, "   "); err != nil {
+		t.Errorf("blank statement: %v", err)
+	}
+	if _, err := ExecReport(db, "INSERT INTO no_such_table VALUES (1)"); err == nil {
+		t.Error("bad statement not reported")
+	}
+}
+
+func TestCount(t *testing.T) {
+	db := newTestDB(t)
+	db.MustExec("INSERT INTO books (title, genre, published_year) VALUES ('A', 'Fantasy', 1990), ('B', 'Fantasy', 2005), ('C', 'Drama', 2010)")
+	if n, err := Count(db, "books", ""); err != nil || n != 3 {
+		t.Errorf("all books: %d, %v", n, err)
+	}
+	if n, err := Count(db, "books", "genre=? AND published_year>?", "Fantasy", 2000); err != nil || n != 1 {
+		t.Errorf("filtered: %d, %v", n, err)
+	}
+	if _, err := Count(db, "sqlite_master", ""); err == nil {
+		t.Error("unknown table accepted")
+	}
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+)
+
+// dbField is a struct field mapped to a column through its db tag.
+type dbField struct {
+	Column string
+	Value  interface{}
+}
+
+// dbFields returns the db-tagged fields of the struct v (or pointer to
+// struct) in declaration order. Fields tagged "-" or without a tag are
+// skipped.
+func dbFields(v interface{}) []dbField {
+	rv := reflect.Indirect(reflect.ValueOf(v))
+	rt := rv.Type()
+	fields := make([]dbField, 0, rt.NumField())
+	for i := 0; i < rt.NumField(); i++ {
+		column := strings.Split(rt.Field(i).Tag.Get("db"), ",")[0]
+		if column == "" || column == "-" {
+			continue
+		}
+		fields = append(fields, dbField{Column: column, Value: rv.Field(i).Interface()})
+	}
+	return fields
+}
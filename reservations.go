@@ -0,0 +1,34 @@
+package main
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Reservation is a member's hold on a book.
+type Reservation struct {
+	ID          int          `db:"id"`
+	BookID      int          `db:"book_id"`
+	MemberID    int          `db:"member_id"`
+	ReservedAt  time.Time    `db:"reserved_at"`
+	FulfilledAt sql.NullTime `db:"fulfilled_at"`
+}
+
+// ReservationWithBook is a reservation together with the reserved book's
+// title.
+type ReservationWithBook struct {
+	Reservation
+	BookTitle string `db:"book_title"`
+}
+
+// MemberReservations returns a member's unfulfilled holds, oldest first.
+func MemberReservations(db *sqlx.DB, memberID int) ([]ReservationWithBook, error) {
+	reservations := []ReservationWithBook{}
+	err := db.Select(&reservations, `SELECT reservations.*, books.title AS book_title
+		FROM reservations JOIN books ON books.id = reservations.book_id
+		WHERE reservations.member_id=? AND reservations.fulfilled_at IS NULL
+		ORDER BY reservations.reserved_at, reservations.id`, memberID)
+	return reservations, err
+}
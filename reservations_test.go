@@ -0,0 +1,33 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestMemberReservations(t *testing.T) {
+	db := newTestDB(t)
+	db.MustExec("INSERT INTO books (id, title) VALUES (1, 'Dune'), (2, 'Emma'), (3, 'Ulysses')")
+	base := time.Date(2024, 2, 1, 9, 0, 0, 0, time.UTC)
+	insert := "INSERT INTO reservations (book_id, member_id, reserved_at, fulfilled_at) VALUES (?, ?, ?, ?)"
+	db.MustExec(insert, 2, 1, base.Add(time.Hour), nil)
+	db.MustExec(insert, 1, 1, base, nil)
+	db.MustExec(insert, 3, 1, base, base.Add(2*time.Hour)) // fulfilled
+	db.MustExec(insert, 3, 2, base, nil)                   // another member
+
+	reservations, err := MemberReservations(db, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var titles []string
+	for _, r := range reservations {
+		titles = append(titles, r.BookTitle)
+	}
+	if want := []string{"Dune", "Emma"}; !reflect.DeepEqual(titles, want) {
+		t.Errorf("titles = %q, want %q", titles, want)
+	}
+	if got, err := MemberReservations(db, 9); err != nil || len(got) != 0 {
+		t.Errorf("member without holds: %v, %v", got, err)
+	}
+}
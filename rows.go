@@ -0,0 +1,66 @@
+package main
+
+import "github.com/jmoiron/sqlx"
+
+// TypedRows iterates over query results, struct-scanning each row into a T.
+//
+//	rows, err := QueryTyped[Book](db, "SELECT * FROM books")
+//	if err != nil {
+//		...
+//	}
+//	defer rows.Close()
+//	for rows.Next() {
+//		book := rows.Value()
+//		...
+//	}
+//	if err := rows.Err(); err != nil {
+//		...
+//	}
+type TypedRows[T any] struct {
+	rows  *sqlx.Rows
+	value T
+	err   error
+}
+
+// QueryTyped runs query and returns its rows as a TypedRows.
+func QueryTyped[T any](db *sqlx.DB, query string, args ...interface{}) (*TypedRows[T], error) {
+	rows, err := db.Queryx(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	return &TypedRows[T]{rows: rows}, nil
+}
+
+// Next advances to the next row and scans it. It returns false when the rows
+// are exhausted or scanning fails; check Err afterwards.
+func (r *TypedRows[T]) Next() bool {
+	if r.err != nil || !r.rows.Next() {
+		return false
+	}
+	var v T
+	if err := r.rows.StructScan(&v); err != nil {
+		r.err = err
+		r.rows.Close()
+		return false
+	}
+	r.value = v
+	return true
+}
+
+// Value returns the row scanned by the last successful call to Next.
+func (r *TypedRows[T]) Value() T {
+	return r.value
+}
+
+// Err returns the error, if any, that ended the iteration.
+func (r *TypedRows[T]) Err() error {
+	if r.err != nil {
+		return r.err
+	}
+	return r.rows.Err()
+}
+
+// Close closes the underlying rows. It is safe to call more than once.
+func (r *TypedRows[T]) Close() error {
+	return r.rows.Close()
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTypedRows(t *testing.T) {
+	db := newTestDB(t)
+	db.MustExec("INSERT INTO books (title) VALUES ('A'), ('B'), ('C')")
+	rows, err := QueryTyped[Book](db, "SELECT * FROM books ORDER BY id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	var titles []string
+	for rows.Next() {
+		titles = append(titles, rows.Value().Title)
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"A", "B", "C"}; !reflect.DeepEqual(titles, want) {
+		t.Errorf("titles = %q, want %q", titles, want)
+	}
+	if err := rows.Close(); err != nil {
+		t.Errorf("second Close: %v", err)
+	}
+}
+
+func TestTypedRowsScanError(t *testing.T) {
+	db := newTestDB(t)
+	rows, err := QueryTyped[Book](db, "SELECT 1 AS no_such_field")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	if rows.Next() {
+		t.Error("Next succeeded despite scan error")
+	}
+	if rows.Err() == nil {
+		t.Error("scan error not reported")
+	}
+	if rows.Next() {
+		t.Error("Next succeeded after an error")
+	}
+}
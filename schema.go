@@ -0,0 +1,151 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// knownTables is the allowlist of tables that helpers taking a table name
+// will accept, since identifiers cannot be bound as query parameters.
+var knownTables = map[string]bool{
+	"authors":              true,
+	"books":                true,
+	"members":              true,
+	"loans":                true,
+	"member_email_history": true,
+	"sequences":            true,
+	"fines":                true,
+	"reservations":         true,
+	"loans_archive":        true,
+}
+
+// checkTable returns an error unless table is in knownTables.
+func checkTable(table string) error {
+	if !knownTables[table] {
+		return fmt.Errorf("unknown table %q", table)
+	}
+	return nil
+}
+
+// ListTables returns the names of all user tables, sorted, leaving out
+// SQLite's internal sqlite_* tables.
+func ListTables(db *sqlx.DB) ([]string, error) {
+	tables := []string{}
+	err := db.Select(&tables, `SELECT name FROM sqlite_master
+		WHERE type='table' AND name NOT LIKE 'sqlite\_%' ESCAPE '\'
+		ORDER BY name`)
+	return tables, err
+}
+
+// DumpSchema returns the CREATE statements of every user table and index,
+// tables first, each terminated by a semicolon. SQLite's internal objects
+// and automatic indexes are left out.
+func DumpSchema(db *sqlx.DB) (string, error) {
+	var statements []string
+	err := db.Select(&statements, `SELECT sql FROM sqlite_master
+		WHERE type IN ('table', 'index') AND sql IS NOT NULL AND name NOT LIKE 'sqlite\_%' ESCAPE '\'
+		ORDER BY CASE type WHEN 'table' THEN 0 ELSE 1 END, name`)
+	if err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	for _, stmt := range statements {
+		b.WriteString(stmt)
+		b.WriteString(";\n\n")
+	}
+	return b.String(), nil
+}
+
+// schemaModels pairs each table with the struct that rows of it are scanned
+// into. VerifySchema checks that the two stay in sync.
+var schemaModels = []struct {
+	table string
+	model interface{}
+}{
+	{"authors", Author{}},
+	{"books", Book{}},
+	{"members", Member{}},
+	{"loans", Loan{}},
+	{"reservations", Reservation{}},
+}
+
+// VerifySchema checks every model struct against its table and returns an
+// error naming each db-tagged field without a column and each column
+// without a field.
+func VerifySchema(db *sqlx.DB) error {
+	var errs []error
+	for _, m := range schemaModels {
+		errs = append(errs, verifyTable(db, m.table, m.model))
+	}
+	return errors.Join(errs...)
+}
+
+// verifyTable compares the db tags of model with the columns of table.
+func verifyTable(db *sqlx.DB, table string, model interface{}) error {
+	var columns []string
+	if err := db.Select(&columns, "SELECT name FROM pragma_table_info(?)", table); err != nil {
+		return err
+	}
+	if len(columns) == 0 {
+		return fmt.Errorf("table %s does not exist", table)
+	}
+	name := reflect.TypeOf(model).Name()
+	inTable := map[string]bool{}
+	for _, c := range columns {
+		inTable[c] = true
+	}
+	inModel := map[string]bool{}
+	var errs []error
+	for _, f := range dbFields(model) {
+		inModel[f.Column] = true
+		if !inTable[f.Column] {
+			errs = append(errs, fmt.Errorf("%s: field for column %q has no matching column in table %s", name, f.Column, table))
+		}
+	}
+	for _, c := range columns {
+		if !inModel[c] {
+			errs = append(errs, fmt.Errorf("%s: column %q has no matching field in %s", table, c, name))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// AddColumn adds a column to table unless a column of that name already
+// exists, so it is safe to run repeatedly. colDef is the column definition
+// as written after ALTER TABLE ... ADD COLUMN, such as "isbn TEXT"; its
+// first word is taken as the column name and must be a plain identifier,
+// and the definition may not contain a semicolon.
+func AddColumn(db *sqlx.DB, table, colDef string) error {
+	if err := checkTable(table); err != nil {
+		return err
+	}
+	fields := strings.Fields(colDef)
+	if len(fields) == 0 || !isIdentifier(fields[0]) || strings.Contains(colDef, ";") {
+		return fmt.Errorf("invalid column definition %q", colDef)
+	}
+	var exists bool
+	err := db.Get(&exists, "SELECT COUNT(*) > 0 FROM pragma_table_info(?) WHERE name = ? COLLATE NOCASE", table, fields[0])
+	if err != nil || exists {
+		return err
+	}
+	_, err = db.Exec("ALTER TABLE " + table + " ADD COLUMN " + colDef)
+	return err
+}
+
+// isIdentifier reports whether s is a bare SQL identifier: a letter or
+// underscore followed by letters, digits or underscores.
+func isIdentifier(s string) bool {
+	for i, r := range s {
+		switch {
+		case r == '_', r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z':
+		case r >= '0' && r <= '9' && i > 0:
+		default:
+			return false
+		}
+	}
+	return s != ""
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestListTables(t *testing.T) {
+	db := newTestDB(t)
+	tables, err := ListTables(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"authors", "books", "fines", "loans", "loans_archive", "member_email_history",
+		"members", "reservations", "schema_migrations", "sequences"}
+	if !reflect.DeepEqual(tables, want) {
+		t.Errorf("tables = %v, want %v", tables, want)
+	}
+}
+
+func TestVerifySchema(t *testing.T) {
+	db := newTestDB(t)
+	if err := VerifySchema(db); err != nil {
+		t.Fatalf("migrated schema: %v", err)
+	}
+	db.MustExec("ALTER TABLE members ADD COLUMN phone TEXT")
+	db.MustExec("ALTER TABLE loans DROP COLUMN renewals")
+	err := VerifySchema(db)
+	if err == nil {
+		t.Fatal("drift not reported")
+	}
+	for _, want := range []string{`column "phone" has no matching field in Member`, `Loan: field for column "renewals"`} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q does not mention %q", err, want)
+		}
+	}
+}
+
+func TestDumpSchema(t *testing.T) {
+	db := newTestDB(t)
+	dump, err := DumpSchema(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// SQLite drops IF NOT EXISTS from the stored statement text.
+	for _, want := range []string{"CREATE TABLE authors", "CREATE TABLE loans_archive", "CREATE INDEX idx_loans_active_book"} {
+		if !strings.Contains(dump, want) {
+			t.Errorf("dump lacks %q", want)
+		}
+	}
+	if strings.Contains(dump, "sqlite_") {
+		t.Error("dump includes SQLite internal objects")
+	}
+	if strings.Index(dump, "CREATE INDEX") < strings.LastIndex(dump, "CREATE TABLE") {
+		t.Error("indexes are not listed after tables")
+	}
+
+	// The dump recreates the same schema in an empty database.
+	fresh := openTestDB(t)
+	fresh.MustExec(dump)
+	again, err := DumpSchema(fresh)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again != dump {
+		t.Errorf("schema differs after restoring the dump:\n%s", again)
+	}
+}
+
+func TestAddColumn(t *testing.T) {
+	db := newTestDB(t)
+	for i := 0; i < 2; i++ {
+		if err := AddColumn(db, "members", "phone TEXT"); err != nil {
+			t.Fatalf("run %d: %v", i+1, err)
+		}
+	}
+	if err := AddColumn(db, "members", "PHONE TEXT"); err != nil {
+		t.Errorf("existing column in another case: %v", err)
+	}
+	if n := count(t, db, "SELECT COUNT(*) FROM pragma_table_info('members') WHERE name='phone'"); n != 1 {
+		t.Errorf("%d phone columns, want 1", n)
+	}
+	for _, tt := range []struct{ table, def string }{
+		{"no_such_table", "x TEXT"},
+		{"members", ""},
+		{"members", "\"x y\" TEXT"},
+		{"members", "x TEXT; DROP TABLE members"},
+	} {
+		if err := AddColumn(db, tt.table, tt.def); err == nil {
+			t.Errorf("AddColumn(%q, %q) accepted", tt.table, tt.def)
+		}
+	}
+}
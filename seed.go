@@ -0,0 +1,51 @@
+package main
+
+import "github.com/jmoiron/sqlx"
+
+// Seed inserts the demo authors, books and members. It is safe to run
+// repeatedly: authors and members are keyed on their unique email, and books
+// are only inserted when no book with the same title exists.
+func Seed(db *sqlx.DB) error {
+	return InTx(db, func(tx *sqlx.Tx) error {
+		authors := []Author{
+			{Name: "J.K. Rowling", Email: "jk.rowling@codeheim.io"},
+			{Name: "George R.R. Martin", Email: "george.martin@codeheim.io"},
+		}
+		for _, a := range authors {
+			if _, err := tx.NamedExec(`INSERT OR IGNORE INTO authors (name, email) VALUES (:name, :email)`, a); err != nil {
+				return err
+			}
+		}
+
+		books := []struct {
+			Title         string `db:"title"`
+			AuthorEmail   string `db:"author_email"`
+			PublishedYear int    `db:"published_year"`
+			Genre         string `db:"genre"`
+		}{
+			{"Harry Potter", "jk.rowling@codeheim.io", 1997, "Fantasy"},
+			{"Game of Thrones", "george.martin@codeheim.io", 1996, "Fantasy"},
+		}
+		for _, b := range books {
+			_, err := tx.NamedExec(`INSERT INTO books (title, author_id, published_year, genre)
+				SELECT :title, (SELECT id FROM authors WHERE email=:author_email), :published_year, :genre
+				WHERE NOT EXISTS (SELECT 1 FROM books WHERE title=:title)`, b)
+			if err != nil {
+				return err
+			}
+		}
+
+		members := []Member{
+			{Name: "John Doe", Email: "john.doe@example.com"},
+			{Name: "Alice", Email: "alice@example.com"},
+			{Name: "Bob", Email: "bob@example.com"},
+			{Name: "Charlie", Email: "charlie@example.com"},
+		}
+		for _, m := range members {
+			if _, err := tx.NamedExec(`INSERT OR IGNORE INTO members (name, email) VALUES (:name, :email)`, m); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,25 @@
+package main
+
+import "testing"
+
+func TestSeedIdempotent(t *testing.T) {
+	db := newTestDB(t)
+	for i := 0; i < 2; i++ {
+		if err := Seed(db); err != nil {
+			t.Fatalf("Seed run %d: %v", i+1, err)
+		}
+	}
+	for table, want := range map[string]int{"authors": 2, "books": 2, "members": 4} {
+		if got := count(t, db, "SELECT COUNT(*) FROM "+table); got != want {
+			t.Errorf("%s: %d rows after two seeds, want %d", table, got, want)
+		}
+	}
+	var authorEmail string
+	if err := db.Get(&authorEmail, `SELECT authors.email FROM books
+		JOIN authors ON authors.id = books.author_id WHERE books.title='Game of Thrones'`); err != nil {
+		t.Fatal(err)
+	}
+	if authorEmail != "george.martin@codeheim.io" {
+		t.Errorf("Game of Thrones is credited to %s", authorEmail)
+	}
+}
@@ -0,0 +1,19 @@
+package main
+
+import "github.com/jmoiron/sqlx"
+
+// NextID returns the next value of the named sequence, starting at 1 for a
+// sequence that has not been used yet. It is for tables whose ids are
+// generated by the application rather than by AUTOINCREMENT.
+//
+// The increment and read happen in one statement inside a write
+// transaction, so concurrent callers never receive the same id.
+func NextID(db *sqlx.DB, sequence string) (int64, error) {
+	return InTxValue(db, func(tx *sqlx.Tx) (int64, error) {
+		var id int64
+		err := tx.Get(&id, `INSERT INTO sequences (name, value) VALUES (?, 1)
+			ON CONFLICT(name) DO UPDATE SET value=value+1
+			RETURNING value`, sequence)
+		return id, err
+	})
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"sort"
+	"sync"
+	"testing"
+)
+
+// TestNextIDConcurrent draws ids from many goroutines at once; run with
+// -race. The ids must be unique and, together, exactly 1..n.
+func TestNextIDConcurrent(t *testing.T) {
+	db := newTestDB(t)
+	const n = 50
+	ids := make([]int64, n)
+	errs := make([]error, n)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			ids[i], errs[i] = NextID(db, "widgets")
+		}(i)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	for i, id := range ids {
+		if id != int64(i+1) {
+			t.Fatalf("sorted ids = %v, want 1..%d", ids, n)
+		}
+	}
+}
+
+func TestNextIDSeparateSequences(t *testing.T) {
+	db := newTestDB(t)
+	for _, want := range []struct {
+		seq string
+		id  int64
+	}{{"a", 1}, {"a", 2}, {"b", 1}, {"a", 3}} {
+		id, err := NextID(db, want.seq)
+		if err != nil || id != want.id {
+			t.Errorf("NextID(%q) = %d, %v, want %d", want.seq, id, err, want.id)
+		}
+	}
+}
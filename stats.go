@@ -0,0 +1,45 @@
+package main
+
+import "github.com/jmoiron/sqlx"
+
+// Stats holds catalog-wide totals.
+type Stats struct {
+	Authors     int `db:"authors"`
+	Books       int `db:"books"`
+	Members     int `db:"members"`
+	ActiveLoans int `db:"active_loans"`
+}
+
+// CatalogStats returns the catalog totals in a single query. Soft-deleted
+// authors are not counted.
+func CatalogStats(db *sqlx.DB) (Stats, error) {
+	var stats Stats
+	err := db.Get(&stats, `SELECT
+		(SELECT COUNT(*) FROM authors WHERE deleted_at IS NULL) AS authors,
+		(SELECT COUNT(*) FROM books) AS books,
+		(SELECT COUNT(*) FROM members) AS members,
+		(SELECT COUNT(*) FROM loans WHERE return_date IS NULL) AS active_loans`)
+	return stats, err
+}
+
+// DurationStats summarizes how long returned loans were out, in days.
+type DurationStats struct {
+	Loans   int     `db:"loans"`
+	AvgDays float64 `db:"avg_days"`
+	MinDays float64 `db:"min_days"`
+	MaxDays float64 `db:"max_days"`
+}
+
+// LoanDurationStats returns the average, shortest and longest time between
+// checkout and return over all returned loans. Active loans are excluded; with
+// no returned loans every field is zero.
+func LoanDurationStats(db *sqlx.DB) (DurationStats, error) {
+	var stats DurationStats
+	err := db.Get(&stats, `SELECT COUNT(*) AS loans,
+		COALESCE(AVG(days), 0) AS avg_days,
+		COALESCE(MIN(days), 0) AS min_days,
+		COALESCE(MAX(days), 0) AS max_days
+		FROM (SELECT julianday(return_date) - julianday(checkout_date) AS days
+			FROM loans WHERE return_date IS NOT NULL)`)
+	return stats, err
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCatalogStats(t *testing.T) {
+	db := newTestDB(t)
+	if err := Seed(db); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	seedLoan(t, db, 1, 1, now, now, nil)
+	seedLoan(t, db, 2, 1, now, now, &now)
+	db.MustExec("INSERT INTO authors (name, email, deleted_at) VALUES ('Gone', 'gone@example.com', ?)", now)
+	stats, err := CatalogStats(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (Stats{Authors: 2, Books: 2, Members: 4, ActiveLoans: 1}); stats != want {
+		t.Errorf("stats = %+v, want %+v", stats, want)
+	}
+}
+
+func TestLoanDurationStats(t *testing.T) {
+	db := newTestDB(t)
+	if stats, err := LoanDurationStats(db); err != nil || stats != (DurationStats{}) {
+		t.Errorf("no loans: %+v, %v, want zeros", stats, err)
+	}
+	checkout := time.Date(2024, 5, 1, 8, 0, 0, 0, time.UTC)
+	due := checkout.AddDate(0, 0, 30)
+	for _, days := range []int{2, 4, 12} {
+		returned := checkout.AddDate(0, 0, days)
+		seedLoan(t, db, 1, 1, checkout, due, &returned)
+	}
+	halfDay := checkout.Add(12 * time.Hour)
+	seedLoan(t, db, 2, 1, checkout, due, &halfDay)
+	seedLoan(t, db, 3, 1, checkout, due, nil) // active, excluded
+
+	stats, err := LoanDurationStats(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (DurationStats{Loans: 4, AvgDays: 4.625, MinDays: 0.5, MaxDays: 12}); stats != want {
+		t.Errorf("stats = %+v, want %+v", stats, want)
+	}
+}
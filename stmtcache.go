@@ -0,0 +1,61 @@
+package main
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// ErrStmtCacheClosed is returned by NamedStmtCache.Prepare after Close.
+var ErrStmtCacheClosed = errors.New("named statement cache is closed")
+
+// NamedStmtCache prepares each named query once and hands out the same
+// *sqlx.NamedStmt on every later call. It is safe for concurrent use; the
+// statements themselves are safe to share between goroutines.
+type NamedStmtCache struct {
+	// prepare prepares a statement on the database; tests may wrap it.
+	prepare func(query string) (*sqlx.NamedStmt, error)
+	mu      sync.Mutex
+	stmts   map[string]*sqlx.NamedStmt
+}
+
+// NewNamedStmtCache returns an empty cache that prepares statements on db.
+func NewNamedStmtCache(db *sqlx.DB) *NamedStmtCache {
+	return &NamedStmtCache{prepare: db.PrepareNamed, stmts: map[string]*sqlx.NamedStmt{}}
+}
+
+// Prepare returns the cached statement for query, preparing it on first use.
+// The returned statement is owned by the cache and must not be closed by the
+// caller.
+func (c *NamedStmtCache) Prepare(query string) (*sqlx.NamedStmt, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.stmts == nil {
+		return nil, ErrStmtCacheClosed
+	}
+	if stmt, ok := c.stmts[query]; ok {
+		return stmt, nil
+	}
+	stmt, err := c.prepare(query)
+	if err != nil {
+		return nil, err
+	}
+	c.stmts[query] = stmt
+	return stmt, nil
+}
+
+// Close closes every cached statement and returns the first error. The cache
+// cannot be used afterwards.
+func (c *NamedStmtCache) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var first error
+	for _, stmt := range c.stmts {
+		if err := stmt.Close(); err != nil && first == nil {
+			first = err
+		}
+	}
+	c.stmts = nil
+	return first
+}
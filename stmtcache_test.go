@@ -0,0 +1,71 @@
+package main
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// countPrepares wraps the cache's prepare func and returns the number of
+// statements it has prepared so far.
+func countPrepares(c *NamedStmtCache) func() int64 {
+	var n atomic.Int64
+	prepare := c.prepare
+	c.prepare = func(query string) (*sqlx.NamedStmt, error) {
+		n.Add(1)
+		return prepare(query)
+	}
+	return n.Load
+}
+
+// TestNamedStmtCacheConcurrent looks up authors through the cache from many
+// goroutines and checks the statement was prepared exactly once. Run with
+// -race.
+func TestNamedStmtCacheConcurrent(t *testing.T) {
+	db := newTestDB(t)
+	db.MustExec("INSERT INTO authors (name, email) VALUES ('Ann', 'ann@example.com'), ('Bob', 'bob@example.com')")
+	cache := NewNamedStmtCache(db)
+	defer cache.Close()
+	prepares := countPrepares(cache)
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 100)
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			name := []string{"Ann", "Bob"}[i%2]
+			authors, err := CachedAuthorsByName(cache, name)
+			if err != nil {
+				errs <- err
+			} else if len(authors) != 1 || authors[0].Name != name {
+				errs <- errors.New("wrong authors for " + name)
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+	if n := prepares(); n != 1 {
+		t.Errorf("prepared %d times, want 1", n)
+	}
+}
+
+func TestNamedStmtCacheClose(t *testing.T) {
+	db := newTestDB(t)
+	cache := NewNamedStmtCache(db)
+	if _, err := cache.Prepare("SELECT * FROM authors WHERE id=:id"); err != nil {
+		t.Fatal(err)
+	}
+	if err := cache.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cache.Prepare("SELECT * FROM authors WHERE id=:id"); !errors.Is(err, ErrStmtCacheClosed) {
+		t.Errorf("Prepare after Close: %v, want ErrStmtCacheClosed", err)
+	}
+}
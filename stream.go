@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// StreamRows runs query and sends each row, struct-scanned into a T, on the
+// returned row channel. When the rows are exhausted, the context is
+// cancelled or an error occurs, the row channel is closed and the error
+// channel then yields exactly one value (nil on success) before closing.
+//
+// Callers should drain the row channel, or cancel ctx, before waiting on the
+// error channel:
+//
+//	rows, errc := StreamRows[Book](ctx, db, "SELECT * FROM books")
+//	for b := range rows {
+//		...
+//	}
+//	if err := <-errc; err != nil {
+//		...
+//	}
+func StreamRows[T any](ctx context.Context, db *sqlx.DB, query string, args ...interface{}) (<-chan T, <-chan error) {
+	out := make(chan T)
+	errc := make(chan error, 1)
+	go func() {
+		err := streamRows(ctx, db, out, query, args...)
+		close(out)
+		errc <- err
+		close(errc)
+	}()
+	return out, errc
+}
+
+// streamRows does the work of StreamRows without owning the channels.
+func streamRows[T any](ctx context.Context, db *sqlx.DB, out chan<- T, query string, args ...interface{}) error {
+	rows, err := db.QueryxContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var v T
+		if err := rows.StructScan(&v); err != nil {
+			return err
+		}
+		select {
+		case out <- v:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	return ctx.Err()
+}
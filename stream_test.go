@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestStreamRows(t *testing.T) {
+	db := newTestDB(t)
+	seedManyBooks(t, db, 100)
+	rows, errc := StreamRows[Book](context.Background(), db, "SELECT * FROM books ORDER BY id")
+	n := 0
+	for b := range rows {
+		n++
+		if b.ID != n {
+			t.Fatalf("row %d has id %d", n, b.ID)
+		}
+	}
+	if err := <-errc; err != nil {
+		t.Fatal(err)
+	}
+	if n != 100 {
+		t.Errorf("streamed %d rows, want 100", n)
+	}
+}
+
+func TestStreamRowsCancel(t *testing.T) {
+	db := newTestDB(t)
+	seedManyBooks(t, db, 100)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	rows, errc := StreamRows[Book](ctx, db, "SELECT * FROM books ORDER BY id")
+	for i := 0; i < 10; i++ {
+		<-rows
+	}
+	cancel()
+	// With nobody receiving, the producer can only see the cancellation,
+	// so the error arrives without draining the rows first.
+	select {
+	case err := <-errc:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("got %v, want context.Canceled", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("error channel not sent after cancel")
+	}
+	if _, ok := <-rows; ok {
+		t.Error("row channel still open after cancel")
+	}
+}
+
+func TestStreamRowsScanError(t *testing.T) {
+	db := newTestDB(t)
+	rows, errc := StreamRows[Book](context.Background(), db, "SELECT 1 AS no_such_field")
+	for range rows {
+		t.Error("row sent despite scan error")
+	}
+	if err := <-errc; err == nil {
+		t.Error("scan error not reported")
+	}
+	if _, ok := <-errc; ok {
+		t.Error("error channel not closed")
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// InsertStruct inserts v, a struct or pointer to struct, into table and
+// returns the new row id. Every db-tagged field except id becomes a column,
+// so the id is always assigned by the database.
+func InsertStruct(db *sqlx.DB, table string, v interface{}) (int64, error) {
+	if err := checkTable(table); err != nil {
+		return 0, err
+	}
+	var columns, params []string
+	for _, f := range dbFields(v) {
+		if f.Column == "id" {
+			continue
+		}
+		columns = append(columns, f.Column)
+		params = append(params, ":"+f.Column)
+	}
+	if len(columns) == 0 {
+		return 0, fmt.Errorf("%T has no columns to insert", v)
+	}
+	result, err := db.NamedExec("INSERT INTO "+table+" ("+strings.Join(columns, ", ")+") VALUES ("+strings.Join(params, ", ")+")", v)
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+// UpdateStruct writes every db-tagged field of v, a struct or pointer to
+// struct, to the row of table with the same id and returns the number of rows
+// affected, which is 0 if no such row exists. v must have an id field.
+func UpdateStruct(db *sqlx.DB, table string, v interface{}) (int64, error) {
+	if err := checkTable(table); err != nil {
+		return 0, err
+	}
+	var sets []string
+	hasID := false
+	for _, f := range dbFields(v) {
+		if f.Column == "id" {
+			hasID = true
+			continue
+		}
+		sets = append(sets, f.Column+"=:"+f.Column)
+	}
+	if !hasID {
+		return 0, fmt.Errorf("%T has no id field", v)
+	}
+	if len(sets) == 0 {
+		return 0, fmt.Errorf("%T has no columns to update", v)
+	}
+	result, err := db.NamedExec("UPDATE "+table+" SET "+strings.Join(sets, ", ")+" WHERE id=:id", v)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
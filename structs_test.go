@@ -0,0 +1,60 @@
+package main
+
+import "testing"
+
+func TestInsertStruct(t *testing.T) {
+	db := newTestDB(t)
+	id, err := InsertStruct(db, "members", Member{ID: 99, Name: "Ann", Email: "ann@example.com", JoinDate: "2024-01-02"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id != 1 {
+		t.Errorf("id = %d, want 1 assigned by the database", id)
+	}
+	var m Member
+	if err := db.Get(&m, "SELECT * FROM members WHERE id=?", id); err != nil {
+		t.Fatal(err)
+	}
+	if m != (Member{ID: 1, Name: "Ann", Email: "ann@example.com", JoinDate: "2024-01-02"}) {
+		t.Errorf("stored member = %+v", m)
+	}
+	if _, err := InsertStruct(db, "members", &Member{Name: "Bob", Email: "bob@example.com", JoinDate: "2024-01-03"}); err != nil {
+		t.Errorf("pointer to struct: %v", err)
+	}
+	if _, err := InsertStruct(db, "no_such_table", Member{}); err == nil {
+		t.Error("unknown table accepted")
+	}
+	if _, err := InsertStruct(db, "members", struct {
+		ID int `db:"id"`
+	}{}); err == nil {
+		t.Error("struct without columns accepted")
+	}
+}
+
+func TestUpdateStruct(t *testing.T) {
+	db := newTestDB(t)
+	db.MustExec("INSERT INTO members (id, name, email, join_date) VALUES (1, 'Ann', 'ann@example.com', '2024-01-02'), (2, 'Bob', 'bob@example.com', '2024-01-03')")
+	updated := Member{ID: 1, Name: "Ann Lee", Email: "ann.lee@example.com", JoinDate: "2024-01-02"}
+	n, err := UpdateStruct(db, "members", &updated)
+	if err != nil || n != 1 {
+		t.Fatalf("update: %d, %v", n, err)
+	}
+	var m Member
+	if err := db.Get(&m, "SELECT * FROM members WHERE id=1"); err != nil {
+		t.Fatal(err)
+	}
+	if m != updated {
+		t.Errorf("stored member = %+v, want %+v", m, updated)
+	}
+	if got := count(t, db, "SELECT COUNT(*) FROM members WHERE id=2 AND name='Bob'"); got != 1 {
+		t.Error("other row changed")
+	}
+	if n, err := UpdateStruct(db, "members", Member{ID: 9, Name: "X", Email: "x@example.com"}); err != nil || n != 0 {
+		t.Errorf("missing row: %d, %v, want 0 rows", n, err)
+	}
+	if _, err := UpdateStruct(db, "members", struct {
+		Name string `db:"name"`
+	}{"X"}); err == nil {
+		t.Error("struct without id accepted")
+	}
+}
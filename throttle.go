@@ -0,0 +1,39 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// NamedStatement is a named query together with the struct or map bound to
+// it.
+type NamedStatement struct {
+	Query string
+	Arg   interface{}
+}
+
+// ThrottledExec runs statements with NamedExec, one after another, starting
+// at most perSecond of them per second. It stops at the first failing
+// statement and returns its error. Statements are not run in a transaction.
+func ThrottledExec(db *sqlx.DB, statements []NamedStatement, perSecond int) error {
+	if perSecond <= 0 {
+		return errors.New("perSecond must be positive")
+	}
+	// Above one per nanosecond the interval would be zero, which NewTicker
+	// rejects; such rates are unlimited in practice.
+	interval := max(time.Second/time.Duration(perSecond), time.Nanosecond)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for i, s := range statements {
+		if i > 0 {
+			<-ticker.C
+		}
+		if _, err := db.NamedExec(s.Query, s.Arg); err != nil {
+			return fmt.Errorf("statement %d: %w", i, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestThrottledExec(t *testing.T) {
+	db := newTestDB(t)
+	statements := make([]NamedStatement, 6)
+	for i := range statements {
+		statements[i] = NamedStatement{
+			Query: "INSERT INTO sequences (name, value) VALUES (:name, :value)",
+			Arg:   map[string]interface{}{"name": string(rune('a' + i)), "value": i},
+		}
+	}
+	start := time.Now()
+	if err := ThrottledExec(db, statements, 50); err != nil {
+		t.Fatal(err)
+	}
+	// Five gaps of 20ms between six statements.
+	if elapsed := time.Since(start); elapsed < 90*time.Millisecond {
+		t.Errorf("ran in %s, want at least 100ms", elapsed)
+	}
+	if n := count(t, db, "SELECT COUNT(*) FROM sequences"); n != 6 {
+		t.Errorf("%d rows inserted, want 6", n)
+	}
+}
+
+func TestThrottledExecStopsOnError(t *testing.T) {
+	db := newTestDB(t)
+	insert := "INSERT INTO sequences (name, value) VALUES (:name, 0)"
+	statements := []NamedStatement{
+		{insert, map[string]interface{}{"name": "a"}},
+		{insert, map[string]interface{}{"name": "a"}},
+		{insert, map[string]interface{}{"name": "b"}},
+	}
+	if err := ThrottledExec(db, statements, 1000); err == nil {
+		t.Fatal("duplicate key not reported")
+	}
+	if n := count(t, db, "SELECT COUNT(*) FROM sequences"); n != 1 {
+		t.Errorf("%d rows inserted, want 1", n)
+	}
+	if err := ThrottledExec(db, statements, 0); err == nil {
+		t.Error("zero rate accepted")
+	}
+	if err := ThrottledExec(db, statements[2:], 2e9); err != nil {
+		t.Errorf("rate above one per nanosecond: %v", err)
+	}
+	if err := ThrottledExec(db, nil, 2e9); err != nil {
+		t.Errorf("no statements: %v", err)
+	}
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// TimeoutDB wraps a database so that Get, Select and Exec give up after
+// Default, failing with context.DeadlineExceeded. A zero or negative Default
+// means no timeout. Other methods of the embedded DB, and the Context
+// variants, are not affected.
+type TimeoutDB struct {
+	*sqlx.DB
+	Default time.Duration
+}
+
+// timeoutContext returns a context that expires after Default, if set.
+func (db TimeoutDB) timeoutContext() (context.Context, context.CancelFunc) {
+	if db.Default <= 0 {
+		return context.Background(), func() {}
+	}
+	return context.WithTimeout(context.Background(), db.Default)
+}
+
+// Get is sqlx.DB.Get with the default timeout.
+func (db TimeoutDB) Get(dest interface{}, query string, args ...interface{}) error {
+	ctx, cancel := db.timeoutContext()
+	defer cancel()
+	return db.DB.GetContext(ctx, dest, query, args...)
+}
+
+// Select is sqlx.DB.Select with the default timeout.
+func (db TimeoutDB) Select(dest interface{}, query string, args ...interface{}) error {
+	ctx, cancel := db.timeoutContext()
+	defer cancel()
+	return db.DB.SelectContext(ctx, dest, query, args...)
+}
+
+// Exec is sqlx.DB.Exec with the default timeout.
+func (db TimeoutDB) Exec(query string, args ...interface{}) (sql.Result, error) {
+	ctx, cancel := db.timeoutContext()
+	defer cancel()
+	return db.DB.ExecContext(ctx, query, args...)
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// slowQuery counts to a hundred million, which takes SQLite several seconds.
+const slowQuery = `WITH RECURSIVE c(x) AS (SELECT 1 UNION ALL SELECT x+1 FROM c WHERE x < 100000000)
+	SELECT COUNT(*) FROM c`
+
+func TestTimeoutDB(t *testing.T) {
+	db := TimeoutDB{DB: newTestDB(t), Default: 20 * time.Millisecond}
+
+	start := time.Now()
+	var n int
+	err := db.Get(&n, slowQuery)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Get: %v, want context.DeadlineExceeded", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Get gave up after %s", elapsed)
+	}
+	var counts []int
+	if err := db.Select(&counts, slowQuery); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Select: %v, want context.DeadlineExceeded", err)
+	}
+	if _, err := db.Exec("CREATE TABLE big AS " + slowQuery); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Exec: %v, want context.DeadlineExceeded", err)
+	}
+
+	// Fast queries are unaffected, and the pool is still usable.
+	if err := db.Get(&n, "SELECT COUNT(*) FROM books"); err != nil {
+		t.Errorf("fast query: %v", err)
+	}
+}
+
+func TestTimeoutDBNoDefault(t *testing.T) {
+	db := TimeoutDB{DB: newTestDB(t)}
+	var n int
+	if err := db.Get(&n, `WITH RECURSIVE c(x) AS (SELECT 1 UNION ALL SELECT x+1 FROM c WHERE x < 100000)
+		SELECT COUNT(*) FROM c`); err != nil || n != 100000 {
+		t.Errorf("Get without timeout: %d, %v", n, err)
+	}
+}
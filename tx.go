@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// InTx runs fn inside a transaction, committing if fn returns nil and
+// rolling back otherwise. A panic in fn also rolls back before re-panicking.
+func InTx(db *sqlx.DB, fn func(*sqlx.Tx) error) error {
+	return InTxContext(context.Background(), db, fn)
+}
+
+// InTxContext is like InTx but binds the transaction to ctx: if ctx is
+// cancelled before the commit, the transaction is rolled back and the
+// context's error is returned.
+func InTxContext(ctx context.Context, db *sqlx.DB, fn func(*sqlx.Tx) error) error {
+	tx, err := db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if p := recover(); p != nil {
+			tx.Rollback()
+			panic(p)
+		}
+	}()
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// InTxValue is like InTx but lets fn produce a result. On rollback the zero
+// value of T is returned along with the error.
+func InTxValue[T any](db *sqlx.DB, fn func(*sqlx.Tx) (T, error)) (T, error) {
+	var result T
+	err := InTx(db, func(tx *sqlx.Tx) error {
+		var err error
+		result, err = fn(tx)
+		return err
+	})
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	return result, nil
+}
+
+// BeginTxLevel starts a transaction with the given isolation level.
+//
+// SQLite transactions are always serializable, and go-sqlite3 ignores the
+// requested level: every level, including sql.LevelSerializable, yields the
+// same transaction, started with the BEGIN mode from the DSN's _txlock
+// parameter (deferred by default). The level still matters when the same
+// code runs against a driver that honours it.
+func BeginTxLevel(db *sqlx.DB, ctx context.Context, level sql.IsolationLevel) (*sqlx.Tx, error) {
+	return db.BeginTxx(ctx, &sql.TxOptions{Isolation: level})
+}
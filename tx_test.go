@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+)
+
+func TestInTxValueCommit(t *testing.T) {
+	db := newTestDB(t)
+	id, err := InTxValue(db, func(tx *sqlx.Tx) (int64, error) {
+		result, err := tx.Exec("INSERT INTO authors (name, email) VALUES ('Ann', 'ann@example.com')")
+		if err != nil {
+			return 0, err
+		}
+		return result.LastInsertId()
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id == 0 {
+		t.Error("got zero id")
+	}
+	if n := count(t, db, "SELECT COUNT(*) FROM authors WHERE id=?", id); n != 1 {
+		t.Errorf("inserted author not committed")
+	}
+}
+
+func TestInTxValueRollback(t *testing.T) {
+	db := newTestDB(t)
+	boom := errors.New("boom")
+	id, err := InTxValue(db, func(tx *sqlx.Tx) (int64, error) {
+		result, err := tx.Exec("INSERT INTO authors (name, email) VALUES ('Ann', 'ann@example.com')")
+		if err != nil {
+			return 0, err
+		}
+		id, _ := result.LastInsertId()
+		return id, boom
+	})
+	if !errors.Is(err, boom) {
+		t.Errorf("err = %v, want boom", err)
+	}
+	if id != 0 {
+		t.Errorf("id = %d, want zero value on rollback", id)
+	}
+	if n := count(t, db, "SELECT COUNT(*) FROM authors"); n != 0 {
+		t.Errorf("%d authors after rollback", n)
+	}
+}
+
+func TestInTxPanicRollsBack(t *testing.T) {
+	db := newTestDB(t)
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("panic was swallowed")
+			}
+		}()
+		InTx(db, func(tx *sqlx.Tx) error {
+			tx.MustExec("INSERT INTO authors (name, email) VALUES ('Ann', 'ann@example.com')")
+			panic("boom")
+		})
+	}()
+	if n := count(t, db, "SELECT COUNT(*) FROM authors"); n != 0 {
+		t.Errorf("%d authors after panic", n)
+	}
+}
+
+func TestBeginTxLevel(t *testing.T) {
+	db := newTestDB(t)
+	for _, level := range []sql.IsolationLevel{sql.LevelDefault, sql.LevelSerializable} {
+		tx, err := BeginTxLevel(db, context.Background(), level)
+		if err != nil {
+			t.Fatalf("%v: %v", level, err)
+		}
+		tx.MustExec("INSERT INTO authors (name, email) VALUES (?, ?)", level.String(), level.String()+"@example.com")
+		if err := tx.Commit(); err != nil {
+			t.Fatalf("%v: %v", level, err)
+		}
+	}
+	if n := count(t, db, "SELECT COUNT(*) FROM authors"); n != 2 {
+		t.Errorf("%d authors committed, want 2", n)
+	}
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// OptString is a nullable string that is friendlier than sql.NullString in
+// JSON APIs: an unset value encodes as null and null decodes as unset.
+// The text lives in String (not Value) so that the type can implement
+// driver.Valuer.
+type OptString struct {
+	String string
+	Set    bool
+}
+
+// OptStringFrom converts a sql.NullString into an OptString.
+func OptStringFrom(ns sql.NullString) OptString {
+	return OptString{String: ns.String, Set: ns.Valid}
+}
+
+// NullString converts the OptString back into a sql.NullString.
+func (o OptString) NullString() sql.NullString {
+	return sql.NullString{String: o.String, Valid: o.Set}
+}
+
+// Scan implements sql.Scanner.
+func (o *OptString) Scan(src interface{}) error {
+	var ns sql.NullString
+	if err := ns.Scan(src); err != nil {
+		return err
+	}
+	*o = OptStringFrom(ns)
+	return nil
+}
+
+// Value implements driver.Valuer.
+func (o OptString) Value() (driver.Value, error) {
+	return o.NullString().Value()
+}
+
+// MarshalJSON encodes an unset OptString as null.
+func (o OptString) MarshalJSON() ([]byte, error) {
+	if !o.Set {
+		return []byte("null"), nil
+	}
+	return json.Marshal(o.String)
+}
+
+// UnmarshalJSON decodes null as an unset OptString.
+func (o *OptString) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		*o = OptString{}
+		return nil
+	}
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	*o = OptString{String: s, Set: true}
+	return nil
+}
+
+// Metadata is free-form book metadata such as an ISBN or tags, stored as a
+// JSON object in a TEXT column. A nil Metadata is stored as NULL.
+type Metadata map[string]interface{}
+
+// Scan implements sql.Scanner. Invalid JSON is reported as an error.
+func (m *Metadata) Scan(src interface{}) error {
+	var data []byte
+	switch v := src.(type) {
+	case nil:
+		*m = nil
+		return nil
+	case string:
+		data = []byte(v)
+	case []byte:
+		data = v
+	default:
+		return fmt.Errorf("metadata: cannot scan %T", src)
+	}
+	var decoded Metadata
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return fmt.Errorf("metadata: %w", err)
+	}
+	*m = decoded
+	return nil
+}
+
+// Value implements driver.Valuer.
+func (m Metadata) Value() (driver.Value, error) {
+	if m == nil {
+		return nil, nil
+	}
+	data, err := json.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
+
+// TrimmedString is a string that drops surrounding whitespace when scanned
+// from or written to the database, for text columns such as author names
+// that may hold stray spaces from imports.
+type TrimmedString string
+
+// Scan implements sql.Scanner. NULL scans as the empty string.
+func (t *TrimmedString) Scan(src interface{}) error {
+	var ns sql.NullString
+	if err := ns.Scan(src); err != nil {
+		return err
+	}
+	*t = TrimmedString(strings.TrimSpace(ns.String))
+	return nil
+}
+
+// Value implements driver.Valuer.
+func (t TrimmedString) Value() (driver.Value, error) {
+	return strings.TrimSpace(string(t)), nil
+}
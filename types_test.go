@@ -0,0 +1,148 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestOptStringScan(t *testing.T) {
+	db := newTestDB(t)
+	var got OptString
+	if err := db.Get(&got, "SELECT NULL"); err != nil {
+		t.Fatal(err)
+	}
+	if got != (OptString{}) {
+		t.Errorf("NULL scanned as %+v", got)
+	}
+	if err := db.Get(&got, "SELECT 'Fantasy'"); err != nil {
+		t.Fatal(err)
+	}
+	if got != (OptString{String: "Fantasy", Set: true}) {
+		t.Errorf("'Fantasy' scanned as %+v", got)
+	}
+}
+
+func TestOptStringValue(t *testing.T) {
+	db := newTestDB(t)
+	db.MustExec("INSERT INTO books (title, genre) VALUES (?, ?), (?, ?)",
+		"set", OptString{String: "Fantasy", Set: true}, "unset", OptString{})
+	var genres []sql.NullString
+	if err := db.Select(&genres, "SELECT genre FROM books ORDER BY id"); err != nil {
+		t.Fatal(err)
+	}
+	if genres[0] != nullString("Fantasy") || genres[1].Valid {
+		t.Errorf("stored %v", genres)
+	}
+}
+
+func TestOptStringFrom(t *testing.T) {
+	ns := nullString("Sci-Fi")
+	o := OptStringFrom(ns)
+	if o != (OptString{String: "Sci-Fi", Set: true}) {
+		t.Errorf("OptStringFrom(%v) = %+v", ns, o)
+	}
+	if o.NullString() != ns {
+		t.Errorf("NullString() = %v", o.NullString())
+	}
+	if OptStringFrom(sql.NullString{}) != (OptString{}) {
+		t.Error("invalid NullString should convert to unset")
+	}
+}
+
+func TestOptStringJSON(t *testing.T) {
+	type payload struct {
+		Genre OptString `json:"genre"`
+	}
+	tests := []struct {
+		in   payload
+		json string
+	}{
+		{payload{OptString{String: "Fantasy", Set: true}}, `{"genre":"Fantasy"}`},
+		{payload{OptString{String: "", Set: true}}, `{"genre":""}`},
+		{payload{}, `{"genre":null}`},
+	}
+	for _, tt := range tests {
+		data, err := json.Marshal(tt.in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != tt.json {
+			t.Errorf("Marshal(%+v) = %s, want %s", tt.in, data, tt.json)
+		}
+		var out payload
+		if err := json.Unmarshal([]byte(tt.json), &out); err != nil {
+			t.Fatal(err)
+		}
+		if out != tt.in {
+			t.Errorf("Unmarshal(%s) = %+v, want %+v", tt.json, out, tt.in)
+		}
+	}
+
+	var absent payload
+	if err := json.Unmarshal([]byte(`{}`), &absent); err != nil {
+		t.Fatal(err)
+	}
+	if absent.Genre.Set {
+		t.Error("absent field decoded as set")
+	}
+	if err := json.Unmarshal([]byte(`{"genre":42}`), &absent); err == nil {
+		t.Error("non-string genre decoded without error")
+	}
+}
+
+func TestMetadataRoundTrip(t *testing.T) {
+	db := newTestDB(t)
+	in := Metadata{"isbn": "978-0439708180", "tags": []interface{}{"wizards", "school"}}
+	db.MustExec("INSERT INTO books (id, title, metadata) VALUES (1, 'A', ?), (2, 'B', ?)", in, Metadata(nil))
+
+	var got Metadata
+	if err := db.Get(&got, "SELECT metadata FROM books WHERE id=1"); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, in) {
+		t.Errorf("metadata = %v, want %v", got, in)
+	}
+	var isbn string
+	if err := db.Get(&isbn, "SELECT json_extract(metadata, '$.isbn') FROM books WHERE id=1"); err != nil || isbn != in["isbn"] {
+		t.Errorf("json_extract isbn = %q, %v", isbn, err)
+	}
+	if n := count(t, db, "SELECT COUNT(*) FROM books WHERE id=2 AND metadata IS NULL"); n != 1 {
+		t.Error("nil metadata not stored as NULL")
+	}
+	got = Metadata{"stale": true}
+	if err := db.Get(&got, "SELECT metadata FROM books WHERE id=2"); err != nil || got != nil {
+		t.Errorf("NULL scanned as %v, %v", got, err)
+	}
+}
+
+func TestMetadataInvalidJSON(t *testing.T) {
+	db := newTestDB(t)
+	db.MustExec("INSERT INTO books (title, metadata) VALUES ('A', '{not json')")
+	var got Metadata
+	if err := db.Get(&got, "SELECT metadata FROM books"); err == nil {
+		t.Error("invalid JSON scanned without error")
+	}
+}
+
+func TestTrimmedString(t *testing.T) {
+	db := newTestDB(t)
+	db.MustExec("INSERT INTO authors (id, name, email) VALUES (1, '  Ann  ', 'ann@example.com')")
+	db.MustExec("INSERT INTO authors (id, name, email) VALUES (2, ?, 'bob@example.com')", TrimmedString("\tBob \n"))
+
+	var names []TrimmedString
+	if err := db.Select(&names, "SELECT name FROM authors ORDER BY id"); err != nil {
+		t.Fatal(err)
+	}
+	if want := []TrimmedString{"Ann", "Bob"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("names = %q, want %q", names, want)
+	}
+	if n := count(t, db, "SELECT COUNT(*) FROM authors WHERE name='Bob'"); n != 1 {
+		t.Error("value not trimmed on write")
+	}
+	var got TrimmedString = "stale"
+	if err := db.Get(&got, "SELECT NULL"); err != nil || got != "" {
+		t.Errorf("NULL scanned as %q, %v", got, err)
+	}
+}